@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"os"
@@ -26,26 +25,9 @@ import (
 	accpb "github.com/infinimesh/proto/node/accounts"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 )
 
-func makeConnection(ctx context.Context) (*grpc.ClientConn, error) {
-	var opts []grpc.DialOption
-	if insec := viper.GetBool("insecure"); insec {
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
-			InsecureSkipVerify: true,
-		})))
-	}
-
-	return grpc.DialContext(ctx, viper.GetString("infinimesh"), opts...)
-}
-
 // make AccountsServiceClient
 func makeAccountsServiceClient(ctx context.Context) (pb.AccountsServiceClient, error) {
 	conn, err := makeConnection(ctx)
@@ -57,7 +39,10 @@ func makeAccountsServiceClient(ctx context.Context) (pb.AccountsServiceClient, e
 
 // make context with bearer token metadata
 func makeContextWithBearerToken() context.Context {
-	token := viper.GetString("token")
+	token, err := loadToken()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Can't load token:", err)
+	}
 	if token == "" {
 		return context.Background()
 	}
@@ -72,23 +57,14 @@ var accountsCmd = &cobra.Command{
 	RunE:    listAccountsCmd.RunE,
 }
 
-func PrintAccountsPool(pool []*accpb.Account) {
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"UUID", "Title", "Enabled", "Default NS"})
-
-	rows := make([]table.Row, len(pool))
-	for i, acc := range pool {
-		rows[i] = table.Row{acc.Uuid, acc.Title, acc.Enabled, acc.DefaultNamespace}
-	}
-	t.AppendRows(rows)
-
-	t.SortBy([]table.SortBy{
-		{Name: "UUID", Mode: table.Asc},
-	})
-
-	t.AppendFooter(table.Row{"Total Found", len(pool)})
-	t.Render()
+func accountsTable(pool []*accpb.Account) *Table {
+	return NewTable("account", pool, (*accpb.Account).GetUuid,
+		Column[*accpb.Account]{Name: "UUID", Value: func(acc *accpb.Account) interface{} { return acc.Uuid }},
+		Column[*accpb.Account]{Name: "Title", Value: func(acc *accpb.Account) interface{} { return acc.Title }},
+		Column[*accpb.Account]{Name: "Enabled", Value: func(acc *accpb.Account) interface{} { return acc.Enabled }},
+		Column[*accpb.Account]{Name: "Default NS", Value: func(acc *accpb.Account) interface{} { return acc.DefaultNamespace }},
+		Column[*accpb.Account]{Name: "Access", Wide: true, Value: func(acc *accpb.Account) interface{} { return accessString(acc.Access) }},
+	).Sort(table.SortBy{Name: "UUID", Mode: table.Asc})
 }
 
 var listAccountsCmd = &cobra.Command{
@@ -102,17 +78,13 @@ var listAccountsCmd = &cobra.Command{
 			return err
 		}
 
-		r, err := client.List(ctx, &pb.EmptyMessage{})
-		if err != nil {
-			return err
-		}
-
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
-		}
-
-		PrintAccountsPool(r.Accounts)
-		return nil
+		return printList(cmd, func() (interface{}, *Table, error) {
+			r, err := client.List(ctx, &pb.EmptyMessage{})
+			if err != nil {
+				return nil, nil, err
+			}
+			return r, accountsTable(r.Accounts).ListedIn("accounts"), nil
+		})
 	},
 }
 
@@ -131,12 +103,7 @@ var getAccountCmd = &cobra.Command{
 			return err
 		}
 
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
-		}
-
-		PrintAccountsPool([]*accpb.Account{r})
-		return nil
+		return printOutput(cmd, r, accountsTable([]*accpb.Account{r}))
 	},
 }
 
@@ -233,12 +200,7 @@ Args:
 			return err
 		}
 
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
-		}
-
-		PrintAccountsPool([]*accpb.Account{r.Account})
-		return nil
+		return printOutput(cmd, r, accountsTable([]*accpb.Account{r.Account}))
 	},
 }
 
@@ -247,6 +209,9 @@ func init() {
 	createAccountCmd.Flags().String("password", "", "Account Password for standard Credentials")
 	createAccountCmd.Flags().String("ldap-provider-key", "", "LDAP Provider Key for LDAP Credentials")
 
+	addListFlags(accountsCmd, listAccountsCmd)
+	addWatchFlags(accountsCmd, listAccountsCmd)
+
 	accountsCmd.AddCommand(getAccountCmd)
 	accountsCmd.AddCommand(listAccountsCmd)
 	accountsCmd.AddCommand(createAccountCmd)
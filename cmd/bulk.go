@@ -0,0 +1,473 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	pb "github.com/infinimesh/proto/node"
+	devpb "github.com/infinimesh/proto/node/devices"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v2"
+)
+
+// bulkRow is a single Device to create, read from CSV row or YAML document
+type bulkRow struct {
+	Row       int
+	Device    *devpb.Device
+	Namespace string
+	Crt       string
+	GenCert   bool
+}
+
+// bulkResult is the outcome of creating a row, as written to the report
+type bulkResult struct {
+	Row    int    `json:"row"`
+	Title  string `json:"title"`
+	Uuid   string `json:"uuid"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	Crt    string `json:"crt,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+var BULK_REPORT_HEADER = []string{"row", "title", "uuid", "result", "error", "crt", "key"}
+
+// readBulkRows reads Devices from CSV (by extension) or multi-document YAML/JSON
+func readBulkRows(path string) ([]*bulkRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch ext := filepath.Ext(path); ext {
+	case ".csv":
+		return readBulkCSV(f)
+	case ".yml", ".yaml", ".json":
+		return readBulkYAML(f)
+	default:
+		return nil, errors.New("Unsupported devices file format " + ext)
+	}
+}
+
+// readBulkCSV reads CSV with header, columns are title, tags (; separated), enabled, namespace, config (json), crt and gen-cert
+func readBulkCSV(r io.Reader) ([]*bulkRow, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 1 {
+		return nil, errors.New("CSV is empty")
+	}
+
+	header := make(map[string]int)
+	for i, col := range records[0] {
+		header[normalizeColumnName(col)] = i
+	}
+	if _, ok := header["title"]; !ok {
+		return nil, errors.New("CSV must have title column")
+	}
+	get := func(record []string, col string) string {
+		if i, ok := header[col]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []*bulkRow
+	for i, record := range records[1:] {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		// Rows are numbered as lines in the file, header being the first one
+		row := &bulkRow{
+			Row:       i + 2,
+			Device:    &devpb.Device{Title: get(record, "title")},
+			Namespace: get(record, "namespace"),
+			Crt:       get(record, "crt"),
+		}
+
+		for _, tag := range strings.Split(get(record, "tags"), ";") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				row.Device.Tags = append(row.Device.Tags, tag)
+			}
+		}
+		if v := get(record, "enabled"); v != "" {
+			if row.Device.Enabled, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("row %d: invalid enabled value %q", row.Row, v)
+			}
+		}
+		if v := get(record, "gencert"); v != "" {
+			if row.GenCert, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("row %d: invalid gen-cert value %q", row.Row, v)
+			}
+		}
+		if v := get(record, "config"); v != "" {
+			row.Device.Config = &structpb.Struct{}
+			if err := row.Device.Config.UnmarshalJSON([]byte(v)); err != nil {
+				return nil, fmt.Errorf("row %d: invalid config: %w", row.Row, err)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readBulkYAML reads YAML documents, each being a Device template with optional namespace, crt and gen_cert keys
+func readBulkYAML(r io.Reader) ([]*bulkRow, error) {
+	dec := yaml.NewDecoder(r)
+	var rows []*bulkRow
+	for doc := 1; ; doc++ {
+		var raw interface{}
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if raw == nil {
+			continue
+		}
+
+		obj, ok := yamlToJson(raw).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("document %d: expected a Device template object", doc)
+		}
+
+		row := &bulkRow{Row: doc, Device: &devpb.Device{}}
+		if v, ok := obj["namespace"].(string); ok {
+			row.Namespace = v
+		}
+		if v, ok := obj["crt"].(string); ok {
+			row.Crt = v
+		}
+		if v, ok := obj["gen_cert"].(bool); ok {
+			row.GenCert = v
+		}
+		delete(obj, "namespace")
+		delete(obj, "crt")
+		delete(obj, "gen_cert")
+
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, row.Device); err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// yamlToJson converts YAML maps with interface{} keys to json compatible ones
+func yamlToJson(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(val))
+		for k, el := range val {
+			res[fmt.Sprint(k)] = yamlToJson(el)
+		}
+		return res
+	case []interface{}:
+		for i, el := range val {
+			val[i] = yamlToJson(el)
+		}
+	}
+	return v
+}
+
+// readBulkReport reads report of the previous run, returning results by row
+func readBulkReport(path string) (map[int]bulkResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[int]bulkResult)
+	for _, record := range records {
+		if len(record) < len(BULK_REPORT_HEADER) {
+			continue
+		}
+		row, err := strconv.Atoi(record[0])
+		if err != nil {
+			// header
+			continue
+		}
+		results[row] = bulkResult{Row: row, Title: record[1], Uuid: record[2], Result: record[3], Error: record[4], Crt: record[5], Key: record[6]}
+	}
+	return results, nil
+}
+
+// bulkReport writes results to CSV as they come, so the report is usable even if the run is interrupted
+type bulkReport struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *csv.Writer
+}
+
+func newBulkReport(path string) (*bulkReport, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := &bulkReport{f: f, w: csv.NewWriter(f)}
+	if err := r.w.Write(BULK_REPORT_HEADER); err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.w.Flush()
+	return r, r.w.Error()
+}
+
+func (r *bulkReport) Write(res bulkResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.w.Write([]string{strconv.Itoa(res.Row), res.Title, res.Uuid, res.Result, res.Error, res.Crt, res.Key}); err != nil {
+		return err
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
+
+func (r *bulkReport) Close() error {
+	return r.f.Close()
+}
+
+// bulkCreateOptions are the flags of bulk create
+type bulkCreateOptions struct {
+	Namespace   string
+	Soft        bool
+	GenCert     bool
+	Cert        certOptions
+	CertDir     string
+	Concurrency int
+}
+
+// createBulkRow creates the Device, reading or generating its certificate first.
+// prev is the result of the row in the report being resumed, if any
+func createBulkRow(ctx context.Context, client pb.DevicesServiceClient, row *bulkRow, prev *bulkResult, opts bulkCreateOptions) bulkResult {
+	res := bulkResult{Row: row.Row, Title: row.Device.Title, Result: DEVICE_RESULT_FAILED}
+	if row.Device.Title == "" {
+		res.Error = "title is empty"
+		return res
+	}
+
+	switch {
+	case row.Crt != "":
+		data, err := readDeviceCertificate(row.Crt)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		res.Crt = row.Crt
+		row.Device.Certificate = &devpb.Certificate{PemData: data}
+	case row.GenCert || opts.GenCert:
+		crt, key, data, err := ensureBulkCertificate(opts.CertDir, fmt.Sprintf("%d-%s", row.Row, row.Device.Title), opts.Cert.forDevice(row.Device.Title), prev)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		res.Crt, res.Key = crt, key
+		row.Device.Certificate = &devpb.Certificate{PemData: string(data)}
+	case row.Device.Certificate == nil && !opts.Soft:
+		res.Error = "no certificate given, set crt, gen-cert or use --soft"
+		return res
+	}
+
+	ns := row.Namespace
+	if ns == "" {
+		ns = opts.Namespace
+	}
+
+	r, err := client.Create(ctx, &devpb.CreateRequest{
+		Device:    row.Device,
+		Namespace: ns,
+	})
+	if err != nil {
+		res.Error = makeCLIError(err).Message
+		return res
+	}
+
+	res.Uuid = r.Device.Uuid
+	res.Result = DEVICE_RESULT_OK
+	return res
+}
+
+// ensureBulkCertificate generates certificate for the row, or reuses the one recorded for it in the resumed report.
+// Any other existing files are never reused, so the key pair of another Device can't be registered by accident
+func ensureBulkCertificate(dir, name string, certOpts certOptions, prev *bulkResult) (crtPath string, keyPath string, certPEM []byte, err error) {
+	crtPath = filepath.Join(dir, unsafeFileNameChars.ReplaceAllString(name, "_")+".crt")
+	keyPath = filepath.Join(dir, unsafeFileNameChars.ReplaceAllString(name, "_")+".key")
+	if prev != nil && prev.Crt == crtPath && prev.Key == keyPath {
+		if _, err := os.Stat(keyPath); err != nil {
+			return "", "", nil, err
+		}
+		certPEM, err = os.ReadFile(crtPath)
+		return crtPath, keyPath, certPEM, err
+	}
+
+	certPEM, keyPEM, err := generateCertificate(certOpts)
+	if err != nil {
+		return "", "", nil, err
+	}
+	crtPath, keyPath, err = writeCertificate(dir, name, certPEM, keyPEM)
+	return crtPath, keyPath, certPEM, err
+}
+
+// bulkCreateDevices creates Devices from the file with bounded concurrency, writing results to report
+func bulkCreateDevices(cmd *cobra.Command, ctx context.Context, client pb.DevicesServiceClient, path string) error {
+	rows, err := readBulkRows(path)
+	if err != nil {
+		return err
+	}
+
+	opts := bulkCreateOptions{}
+	opts.Namespace, _ = cmd.Flags().GetString("namespace")
+	if opts.Namespace == "" {
+		opts.Namespace = viper.GetString("namespace")
+	}
+	opts.Soft, _ = cmd.Flags().GetBool("soft")
+	opts.GenCert, _ = cmd.Flags().GetBool("gen-cert")
+	if opts.Cert, err = certOptionsFromFlags(cmd); err != nil {
+		return err
+	}
+	opts.CertDir, _ = cmd.Flags().GetString("cert-dir")
+	opts.Concurrency, _ = cmd.Flags().GetInt("concurrency")
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	reportPath, _ := cmd.Flags().GetString("report")
+	if reportPath == "" {
+		reportPath = strings.TrimSuffix(path, filepath.Ext(path)) + ".report.csv"
+	}
+
+	previous := make(map[int]bulkResult)
+	if resume, _ := cmd.Flags().GetString("resume"); resume != "" {
+		previous, err = readBulkReport(resume)
+		if err != nil {
+			return fmt.Errorf("can't read report to resume from: %w", err)
+		}
+	}
+
+	report, err := newBulkReport(reportPath)
+	if err != nil {
+		return err
+	}
+	defer report.Close()
+
+	results := make([]bulkResult, len(rows))
+	var todo []int
+	prevs := make([]*bulkResult, len(rows))
+	for i, row := range rows {
+		res, ok := previous[row.Row]
+		if !ok || res.Title != row.Device.Title {
+			todo = append(todo, i)
+			continue
+		}
+		if res.Result != DEVICE_RESULT_OK {
+			prevs[i] = &res
+			todo = append(todo, i)
+			continue
+		}
+
+		res.Result = DEVICE_RESULT_SKIPPED
+		results[i] = res
+		// Keep succeeded rows in the report, so it can be resumed from again
+		res.Result = DEVICE_RESULT_OK
+		if err := report.Write(res); err != nil {
+			return err
+		}
+	}
+
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	var reportErr error
+	var mu sync.Mutex
+	for _, i := range todo {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			res := createBulkRow(ctx, client, rows[i], prevs[i], opts)
+			results[i] = res
+			if err := report.Write(res); err != nil {
+				mu.Lock()
+				reportErr = err
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if reportErr != nil {
+		return fmt.Errorf("error writing report: %w", reportErr)
+	}
+
+	if err := printOutput(cmd, results, bulkResultsTable(results)); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Report written to", reportPath)
+
+	failed := 0
+	for _, res := range results {
+		if res.Result == DEVICE_RESULT_FAILED {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d Devices failed, fix them and run again with --resume %s", failed, len(results), reportPath)
+	}
+	return nil
+}
+
+func bulkResultsTable(results []bulkResult) *Table {
+	return NewTable("row", results, func(res bulkResult) string { return strconv.Itoa(res.Row) },
+		Column[bulkResult]{Name: "Row", Value: func(res bulkResult) interface{} { return res.Row }},
+		Column[bulkResult]{Name: "Title", Value: func(res bulkResult) interface{} { return res.Title }},
+		Column[bulkResult]{Name: "UUID", Value: func(res bulkResult) interface{} { return res.Uuid }},
+		Column[bulkResult]{Name: "Result", Value: func(res bulkResult) interface{} { return res.Result }},
+		Column[bulkResult]{Name: "Error", Value: func(res bulkResult) interface{} { return res.Error }},
+		Column[bulkResult]{Name: "Certificate", Wide: true, Value: func(res bulkResult) interface{} { return res.Crt }},
+		Column[bulkResult]{Name: "Key", Wide: true, Value: func(res bulkResult) interface{} { return res.Key }},
+	)
+}
@@ -0,0 +1,648 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Files of the local CA, see caDir
+const (
+	CA_CERT_FILE       = "ca.crt"
+	CA_KEY_FILE        = "ca.key"
+	CA_INDEX_FILE      = "index.txt"
+	CA_CRL_FILE        = "crl.pem"
+	CA_CRL_NUMBER_FILE = "crlnumber"
+	CA_ISSUED_DIR      = "issued"
+)
+
+// Statuses of the certificates in the index, same as in OpenSSL index.txt
+const (
+	CA_STATUS_VALID   = "V"
+	CA_STATUS_REVOKED = "R"
+	CA_STATUS_EXPIRED = "E"
+)
+
+// CA_REVOCATION_REASONS are CRL reason codes as of RFC 5280
+var CA_REVOCATION_REASONS = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"cACompromise":         2,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+	"privilegeWithdrawn":   9,
+}
+
+var oidCRLReason = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// Layouts of the index times, UTCTime is used by OpenSSL before 2050
+const (
+	CA_INDEX_TIME_LAYOUT     = "20060102150405Z"
+	CA_INDEX_UTC_TIME_LAYOUT = "060102150405Z"
+)
+
+// caDir is where the local CA of the current context lives
+func caDir() string {
+	return filepath.Join(contextDir(infContext), "ca")
+}
+
+// caIndexEntry is the issued certificate record, stored as OpenSSL index.txt line
+type caIndexEntry struct {
+	Status  string     `json:"status"`
+	Expires time.Time  `json:"expires"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+	Serial  string     `json:"serial"`
+	Subject string     `json:"subject"`
+}
+
+func (e *caIndexEntry) serial() *big.Int {
+	serial, _ := new(big.Int).SetString(e.Serial, 16)
+	return serial
+}
+
+// status tells whether certificate is revoked, expired or still valid
+func (e *caIndexEntry) status() string {
+	if e.Status == CA_STATUS_VALID && time.Now().After(e.Expires) {
+		return CA_STATUS_EXPIRED
+	}
+	return e.Status
+}
+
+func formatSerial(serial *big.Int) string {
+	s := fmt.Sprintf("%X", serial)
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	return s
+}
+
+func parseIndexTime(s string) (time.Time, error) {
+	if len(s) == len(CA_INDEX_UTC_TIME_LAYOUT) {
+		return time.Parse(CA_INDEX_UTC_TIME_LAYOUT, s)
+	}
+	return time.Parse(CA_INDEX_TIME_LAYOUT, s)
+}
+
+// readCAIndex reads the index, it's empty if there is no file yet
+func readCAIndex(dir string) ([]*caIndexEntry, error) {
+	f, err := os.Open(filepath.Join(dir, CA_INDEX_FILE))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*caIndexEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("%s:%d: expected 6 tab separated fields, got %d", CA_INDEX_FILE, line, len(fields))
+		}
+
+		e := &caIndexEntry{Status: fields[0], Serial: fields[3], Subject: fields[5]}
+		if e.Expires, err = parseIndexTime(fields[1]); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid expiry: %w", CA_INDEX_FILE, line, err)
+		}
+		if fields[2] != "" {
+			revoked, reason, _ := strings.Cut(fields[2], ",")
+			t, err := parseIndexTime(revoked)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid revocation time: %w", CA_INDEX_FILE, line, err)
+			}
+			e.Revoked, e.Reason = &t, reason
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// writeCAIndex replaces the index, writing it to temporary file first
+func writeCAIndex(dir string, entries []*caIndexEntry) error {
+	var b strings.Builder
+	for _, e := range entries {
+		revoked := ""
+		if e.Revoked != nil {
+			revoked = e.Revoked.UTC().Format(CA_INDEX_TIME_LAYOUT)
+			if e.Reason != "" {
+				revoked += "," + e.Reason
+			}
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\tunknown\t%s\n", e.Status, e.Expires.UTC().Format(CA_INDEX_TIME_LAYOUT), revoked, e.Serial, e.Subject)
+	}
+
+	path := filepath.Join(dir, CA_INDEX_FILE)
+	if err := os.WriteFile(path+".tmp", []byte(b.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readCACertificate reads the local CA certificate
+func readCACertificate(dir string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(filepath.Join(dir, CA_CERT_FILE))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("CA is not initialized at %s, run inf ca init", dir)
+	} else if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", filepath.Join(dir, CA_CERT_FILE))
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// loadCA reads the local CA certificate and private key
+func loadCA(dir string) (*x509.Certificate, crypto.Signer, error) {
+	ca, err := readCACertificate(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, CA_KEY_FILE))
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no private key found in %s", filepath.Join(dir, CA_KEY_FILE))
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("unsupported CA private key type")
+	}
+	return ca, signer, nil
+}
+
+// nextSerial returns serial following the largest issued one, starting with 1
+func nextSerial(entries []*caIndexEntry) *big.Int {
+	serial := big.NewInt(0)
+	for _, e := range entries {
+		if s := e.serial(); s != nil && s.Cmp(serial) > 0 {
+			serial = s
+		}
+	}
+	return serial.Add(serial, big.NewInt(1))
+}
+
+// findIndexEntry finds certificate in the index by serial
+func findIndexEntry(entries []*caIndexEntry, serial *big.Int) *caIndexEntry {
+	for _, e := range entries {
+		if s := e.serial(); s != nil && s.Cmp(serial) == 0 {
+			return e
+		}
+	}
+	return nil
+}
+
+// writeCRL signs CRL with all revoked certificates of the index, valid for the given duration
+func writeCRL(dir string, ca *x509.Certificate, key crypto.Signer, entries []*caIndexEntry, validity time.Duration) (string, error) {
+	number := big.NewInt(1)
+	if data, err := os.ReadFile(filepath.Join(dir, CA_CRL_NUMBER_FILE)); err == nil {
+		if n, ok := new(big.Int).SetString(strings.TrimSpace(string(data)), 16); ok {
+			number = n
+		}
+	}
+
+	var revoked []pkix.RevokedCertificate
+	for _, e := range entries {
+		if e.Status != CA_STATUS_REVOKED || e.Revoked == nil {
+			continue
+		}
+		rc := pkix.RevokedCertificate{SerialNumber: e.serial(), RevocationTime: *e.Revoked}
+		if code, ok := CA_REVOCATION_REASONS[e.Reason]; ok && code != 0 {
+			value, err := asn1.Marshal(asn1.Enumerated(code))
+			if err != nil {
+				return "", err
+			}
+			rc.Extensions = []pkix.Extension{{Id: oidCRLReason, Value: value}}
+		}
+		revoked = append(revoked, rc)
+	}
+
+	now := time.Now()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              number,
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(validity),
+		RevokedCertificates: revoked,
+	}, ca, key)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, CA_CRL_FILE)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0644); err != nil {
+		return "", err
+	}
+	next := formatSerial(number.Add(number, big.NewInt(1)))
+	return path, os.WriteFile(filepath.Join(dir, CA_CRL_NUMBER_FILE), []byte(next+"\n"), 0600)
+}
+
+// checkLocalCARevocation fails if certificate was issued by the local CA and revoked since
+func checkLocalCARevocation(cert *x509.Certificate) error {
+	dir := caDir()
+	ca, err := readCACertificate(dir)
+	if err != nil || cert.CheckSignatureFrom(ca) != nil {
+		return nil
+	}
+
+	entries, err := readCAIndex(dir)
+	if err != nil {
+		return err
+	}
+	if e := findIndexEntry(entries, cert.SerialNumber); e != nil && e.Status == CA_STATUS_REVOKED {
+		return fmt.Errorf("certificate %s (%s) is revoked by the local CA", e.Serial, e.Subject)
+	}
+	return nil
+}
+
+func caIndexTable(entries []*caIndexEntry) *Table {
+	statuses := map[string]string{
+		CA_STATUS_VALID:   "Valid",
+		CA_STATUS_REVOKED: "Revoked",
+		CA_STATUS_EXPIRED: "Expired",
+	}
+	return NewTable("certificate", entries, func(e *caIndexEntry) string { return e.Serial },
+		Column[*caIndexEntry]{Name: "Serial", Value: func(e *caIndexEntry) interface{} { return e.Serial }},
+		Column[*caIndexEntry]{Name: "Subject", Value: func(e *caIndexEntry) interface{} { return e.Subject }},
+		Column[*caIndexEntry]{Name: "Status", Value: func(e *caIndexEntry) interface{} { return statuses[e.status()] }},
+		Column[*caIndexEntry]{Name: "Expires", Value: func(e *caIndexEntry) interface{} { return e.Expires.Local().Format(time.RFC1123) }},
+		Column[*caIndexEntry]{Name: "Revoked", Wide: true, Value: func(e *caIndexEntry) interface{} {
+			if e.Revoked == nil {
+				return ""
+			}
+			return e.Revoked.Local().Format(time.RFC1123)
+		}},
+		Column[*caIndexEntry]{Name: "Reason", Wide: true, Value: func(e *caIndexEntry) interface{} { return e.Reason }},
+	)
+}
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage local Certificate Authority issuing Device certificates",
+	Long: `Manage local Certificate Authority issuing Device certificates
+
+CA lives in the context directory (see inf config path), its certificate, key,
+index of issued certificates (OpenSSL index.txt format) and CRL are kept there.`,
+}
+
+var caInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create local CA key and certificate",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := caDir()
+		if _, err := os.Stat(filepath.Join(dir, CA_KEY_FILE)); err == nil {
+			return fmt.Errorf("CA is already initialized at %s", dir)
+		}
+
+		opts, err := certOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		crlValidity, err := crlValidityFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		if opts.Subject.CommonName == "" {
+			opts.Subject.CommonName = fmt.Sprintf("infinimesh CLI CA (%s)", infContext)
+		}
+
+		key, err := generateKey(opts.Algorithm, opts.RSABits)
+		if err != nil {
+			return err
+		}
+		template, err := certificateTemplate(opts, nil)
+		if err != nil {
+			return err
+		}
+		template.IsCA = true
+		template.MaxPathLenZero = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = nil
+
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			return err
+		}
+		keyPEM, err := encodePrivateKey(key)
+		if err != nil {
+			return err
+		}
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+		ca, err := x509.ParseCertificate(der)
+		if err != nil {
+			return err
+		}
+
+		crtPath, keyPath, err := writeCertificate(dir, strings.TrimSuffix(CA_CERT_FILE, ".crt"), certPEM, keyPEM)
+		if err != nil {
+			return err
+		}
+		// Half initialized CA is removed, so init can be run again
+		if _, err := writeCRL(dir, ca, key, nil, crlValidity); err != nil {
+			removeFiles([]string{crtPath, keyPath, filepath.Join(dir, CA_CRL_FILE), filepath.Join(dir, CA_CRL_NUMBER_FILE)})
+			return err
+		}
+
+		fmt.Printf("CA %s initialized at %s\n", ca.Subject, dir)
+		fmt.Println("Certificate:", crtPath)
+		fmt.Println("Fingerprint:", certificateFingerprint(ca))
+		return nil
+	},
+}
+
+var caIssueCmd = &cobra.Command{
+	Use:   "issue <device-title>",
+	Short: "Issue Device certificate signed by the local CA",
+	Long: `Issue Device certificate signed by the local CA
+
+Certificate (followed by the CA certificate) and key are written to --cert-dir as <device-title>.crt and <device-title>.key,
+certificate can be then used with inf devices create --crt <device-title>.crt`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := caDir()
+		ca, caKey, err := loadCA(dir)
+		if err != nil {
+			return err
+		}
+		entries, err := readCAIndex(dir)
+		if err != nil {
+			return err
+		}
+
+		opts, err := certOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		opts = opts.forDevice(args[0])
+
+		serial := nextSerial(entries)
+		certPEM, keyPEM, err := issueCertificate(opts, serial, ca, caKey)
+		if err != nil {
+			return err
+		}
+		cert, err := x509.ParseCertificate(mustDecodePEM(certPEM))
+		if err != nil {
+			return err
+		}
+
+		// Serial is reserved in the index first, so it's never handed out twice even if writing files fails
+		entries = append(entries, &caIndexEntry{
+			Status:  CA_STATUS_VALID,
+			Expires: cert.NotAfter,
+			Serial:  formatSerial(serial),
+			Subject: cert.Subject.String(),
+		})
+		if err := writeCAIndex(dir, entries); err != nil {
+			return err
+		}
+
+		crtPath, keyPath, err := writeIssuedCertificate(cmd, dir, args[0], serial, certPEM, keyPEM, ca)
+		if err != nil {
+			if rerr := writeCAIndex(dir, entries[:len(entries)-1]); rerr != nil {
+				return fmt.Errorf("%w, removing serial %s from the index failed too: %w", err, formatSerial(serial), rerr)
+			}
+			return err
+		}
+
+		fmt.Printf("Issued certificate %s for %s, valid until %s\n", formatSerial(serial), cert.Subject, cert.NotAfter.Local().Format(time.RFC1123))
+		fmt.Println("Certificate:", crtPath)
+		fmt.Println("Key:", keyPath)
+		fmt.Println("Fingerprint:", certificateFingerprint(cert))
+		return nil
+	},
+}
+
+// writeIssuedCertificate keeps copy of the certificate in the CA and writes it with the CA chain and key to --cert-dir,
+// written files are removed if any of it fails
+func writeIssuedCertificate(cmd *cobra.Command, dir, name string, serial *big.Int, certPEM, keyPEM []byte, ca *x509.Certificate) (crtPath string, keyPath string, err error) {
+	issued := filepath.Join(dir, CA_ISSUED_DIR)
+	if err := os.MkdirAll(issued, 0700); err != nil {
+		return "", "", err
+	}
+	copyPath := filepath.Join(issued, formatSerial(serial)+".pem")
+	if err := os.WriteFile(copyPath, certPEM, 0600); err != nil {
+		os.Remove(copyPath)
+		return "", "", err
+	}
+
+	certDir, _ := cmd.Flags().GetString("cert-dir")
+	chain := append(append([]byte{}, certPEM...), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})...)
+	crtPath, keyPath, err = writeCertificate(certDir, name, chain, keyPEM)
+	if err != nil {
+		os.Remove(copyPath)
+		return "", "", err
+	}
+	return crtPath, keyPath, nil
+}
+
+// mustDecodePEM returns DER of the first PEM block, which is known to be there
+func mustDecodePEM(data []byte) []byte {
+	block, _ := pem.Decode(data)
+	return block.Bytes
+}
+
+var caRevokeCmd = &cobra.Command{
+	Use:   "revoke <serial|certificate.crt>...",
+	Short: "Revoke certificates issued by the local CA and update CRL",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		reason, _ := cmd.Flags().GetString("reason")
+		if _, ok := CA_REVOCATION_REASONS[reason]; !ok {
+			var reasons []string
+			for r := range CA_REVOCATION_REASONS {
+				reasons = append(reasons, r)
+			}
+			sort.Strings(reasons)
+			return usageError{fmt.Errorf("unknown revocation reason %q, supported are: %s", reason, strings.Join(reasons, ", "))}
+		}
+		crlValidity, err := crlValidityFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		dir := caDir()
+		ca, caKey, err := loadCA(dir)
+		if err != nil {
+			return err
+		}
+		entries, err := readCAIndex(dir)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		for _, arg := range args {
+			serial, err := revocationSerial(arg)
+			if err != nil {
+				return err
+			}
+			e := findIndexEntry(entries, serial)
+			if e == nil {
+				return fmt.Errorf("certificate %s wasn't issued by the local CA", formatSerial(serial))
+			}
+			if e.Status == CA_STATUS_REVOKED {
+				fmt.Printf("Certificate %s (%s) is already revoked\n", e.Serial, e.Subject)
+				continue
+			}
+			e.Status, e.Revoked, e.Reason = CA_STATUS_REVOKED, &now, reason
+			fmt.Printf("Revoked certificate %s (%s)\n", e.Serial, e.Subject)
+		}
+
+		if err := writeCAIndex(dir, entries); err != nil {
+			return err
+		}
+		path, err := writeCRL(dir, ca, caKey, entries, crlValidity)
+		if err != nil {
+			return err
+		}
+		fmt.Println("CRL written to", path)
+		return nil
+	},
+}
+
+// revocationSerial reads serial from certificate file, or parses it as hex
+func revocationSerial(arg string) (*big.Int, error) {
+	if _, err := os.Stat(arg); err == nil {
+		cert, err := readCertificateFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return cert.SerialNumber, nil
+	}
+
+	serial, ok := new(big.Int).SetString(strings.TrimPrefix(strings.ReplaceAll(arg, ":", ""), "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("%s is neither certificate file nor hex serial", arg)
+	}
+	return serial, nil
+}
+
+var caCrlCmd = &cobra.Command{
+	Use:   "crl",
+	Short: "Regenerate CRL of the local CA, e.g. before it expires",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		crlValidity, err := crlValidityFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		dir := caDir()
+		ca, caKey, err := loadCA(dir)
+		if err != nil {
+			return err
+		}
+		entries, err := readCAIndex(dir)
+		if err != nil {
+			return err
+		}
+
+		path, err := writeCRL(dir, ca, caKey, entries, crlValidity)
+		if err != nil {
+			return err
+		}
+		fmt.Println("CRL written to", path)
+		return nil
+	},
+}
+
+var caListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"l", "ls"},
+	Short:   "List certificates issued by the local CA",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := caDir()
+		if _, err := readCACertificate(dir); err != nil {
+			return err
+		}
+		entries, err := readCAIndex(dir)
+		if err != nil {
+			return err
+		}
+		return printOutput(cmd, entries, caIndexTable(entries))
+	},
+}
+
+// crlValidityFromFlags reads --crl-validity
+func crlValidityFromFlags(cmd *cobra.Command) (time.Duration, error) {
+	s, _ := cmd.Flags().GetString("crl-validity")
+	validity, err := parseDuration(s)
+	if err != nil {
+		return 0, usageError{fmt.Errorf("invalid CRL validity: %w", err)}
+	}
+	if validity <= 0 {
+		return 0, usageError{fmt.Errorf("CRL validity must be positive, got %s", s)}
+	}
+	return validity, nil
+}
+
+func init() {
+	caInitCmd.Flags().String("key-alg", KEY_ALG_ECDSA, "Key algorithm of the CA, one of: "+strings.Join(KEY_ALGS, ", "))
+	caInitCmd.Flags().Int("rsa-bits", 4096, "RSA key size")
+	caInitCmd.Flags().String("subject", "", "Subject of the CA certificate, e.g. /CN=Acme Devices CA/O=Acme")
+	caInitCmd.Flags().String("validity", "3650d", "Validity of the CA certificate")
+	caCmd.AddCommand(caInitCmd)
+
+	addCertGenFlags(caIssueCmd)
+	caCmd.AddCommand(caIssueCmd)
+
+	caRevokeCmd.Flags().String("reason", "unspecified", "Revocation reason, e.g. keyCompromise, superseded or cessationOfOperation")
+	caCmd.AddCommand(caRevokeCmd)
+
+	caCmd.AddCommand(caCrlCmd)
+
+	addListFlags(caListCmd)
+	caCmd.AddCommand(caListCmd)
+
+	for _, cmd := range []*cobra.Command{caInitCmd, caRevokeCmd, caCrlCmd} {
+		cmd.Flags().String("crl-validity", "30d", "How long the CRL is valid until the next update")
+	}
+
+	rootCmd.AddCommand(caCmd)
+}
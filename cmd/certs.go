@@ -0,0 +1,343 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Default validity of generated device certificates
+const DEVICE_CERT_VALIDITY = 365 * 24 * time.Hour
+
+// Supported key algorithms of generated certificates
+const (
+	KEY_ALG_ECDSA   = "ecdsa"
+	KEY_ALG_ED25519 = "ed25519"
+	KEY_ALG_RSA     = "rsa"
+)
+
+var KEY_ALGS = []string{KEY_ALG_ECDSA, KEY_ALG_ED25519, KEY_ALG_RSA}
+
+// certOptions describe the device certificate to generate
+type certOptions struct {
+	Algorithm string
+	RSABits   int
+	Subject   pkix.Name
+	Validity  time.Duration
+}
+
+// generateKey generates private key of given algorithm, ECDSA P-256 by default
+func generateKey(alg string, rsaBits int) (crypto.Signer, error) {
+	switch strings.ToLower(alg) {
+	case "", KEY_ALG_ECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KEY_ALG_ED25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case KEY_ALG_RSA:
+		if rsaBits == 0 {
+			rsaBits = 2048
+		}
+		if rsaBits < 2048 {
+			return nil, fmt.Errorf("RSA key must be at least 2048 bits, got %d", rsaBits)
+		}
+		return rsa.GenerateKey(rand.Reader, rsaBits)
+	}
+	return nil, fmt.Errorf("unsupported key algorithm %q, supported are: %s", alg, strings.Join(KEY_ALGS, ", "))
+}
+
+// generateCertificate generates key pair and self-signed certificate, returned PEM encoded
+func generateCertificate(opts certOptions) (certPEM []byte, keyPEM []byte, err error) {
+	return issueCertificate(opts, nil, nil, nil)
+}
+
+// issueCertificate generates key pair and certificate signed by the CA, self-signed if CA is nil
+// Serial is random unless given
+func issueCertificate(opts certOptions, serial *big.Int, ca *x509.Certificate, caKey crypto.Signer) (certPEM []byte, keyPEM []byte, err error) {
+	key, err := generateKey(opts.Algorithm, opts.RSABits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := certificateTemplate(opts, serial)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca, caKey
+		// Certificate can't outlive its issuer
+		if template.NotAfter.After(ca.NotAfter) {
+			template.NotAfter = ca.NotAfter
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err = encodePrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return certPEM, keyPEM, nil
+}
+
+// certificateTemplate makes client certificate template, with random serial if not given
+func certificateTemplate(opts certOptions, serial *big.Int) (*x509.Certificate, error) {
+	if serial == nil {
+		var err error
+		serial, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	validity := opts.Validity
+	if validity <= 0 {
+		validity = DEVICE_CERT_VALIDITY
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               opts.Subject,
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}, nil
+}
+
+// encodePrivateKey encodes key as PKCS #8 PEM
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// parseSubject parses subject as /CN=pump-1/O=Acme/C=DE or CN=pump-1,O=Acme,C=DE
+func parseSubject(s string) (pkix.Name, error) {
+	var name pkix.Name
+	sep := ","
+	if strings.HasPrefix(s, "/") {
+		sep = "/"
+	}
+
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return name, fmt.Errorf("invalid subject part %q, expected <attribute>=<value>", part)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToUpper(strings.TrimSpace(key)) {
+		case "CN":
+			name.CommonName = value
+		case "O":
+			name.Organization = append(name.Organization, value)
+		case "OU":
+			name.OrganizationalUnit = append(name.OrganizationalUnit, value)
+		case "C":
+			name.Country = append(name.Country, value)
+		case "ST":
+			name.Province = append(name.Province, value)
+		case "L":
+			name.Locality = append(name.Locality, value)
+		case "SERIALNUMBER":
+			name.SerialNumber = value
+		default:
+			return name, fmt.Errorf("unsupported subject attribute %q, supported are: CN, O, OU, C, ST, L, serialNumber", key)
+		}
+	}
+	return name, nil
+}
+
+// certOptionsFromFlags reads certificate generation flags, Common Name defaults to the device title
+func certOptionsFromFlags(cmd *cobra.Command) (certOptions, error) {
+	opts := certOptions{}
+	opts.Algorithm, _ = cmd.Flags().GetString("key-alg")
+	opts.RSABits, _ = cmd.Flags().GetInt("rsa-bits")
+
+	if subject, _ := cmd.Flags().GetString("subject"); subject != "" {
+		var err error
+		if opts.Subject, err = parseSubject(subject); err != nil {
+			return opts, usageError{err}
+		}
+	}
+
+	if validity, _ := cmd.Flags().GetString("validity"); validity != "" {
+		var err error
+		if opts.Validity, err = parseDuration(validity); err != nil {
+			return opts, usageError{fmt.Errorf("invalid validity: %w", err)}
+		}
+		if opts.Validity <= 0 {
+			return opts, usageError{fmt.Errorf("validity must be positive, got %s", validity)}
+		}
+	}
+
+	// Fail early on unsupported algorithm rather than per device
+	if opts.Algorithm != "" && !containsString(KEY_ALGS, strings.ToLower(opts.Algorithm)) {
+		return opts, usageError{fmt.Errorf("unsupported key algorithm %q, supported are: %s", opts.Algorithm, strings.Join(KEY_ALGS, ", "))}
+	}
+	return opts, nil
+}
+
+// forDevice returns options with Common Name set to the device title unless given in subject
+func (opts certOptions) forDevice(title string) certOptions {
+	if opts.Subject.CommonName == "" {
+		opts.Subject.CommonName = title
+	}
+	return opts
+}
+
+// addCertGenFlags adds flags to generate device certificates
+func addCertGenFlags(cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		cmd.Flags().String("key-alg", KEY_ALG_ECDSA, "Key algorithm of generated certificate, one of: "+strings.Join(KEY_ALGS, ", "))
+		cmd.Flags().Int("rsa-bits", 2048, "RSA key size")
+		cmd.Flags().String("subject", "", "Subject of generated certificate, e.g. /CN=pump-1/O=Acme/C=DE (CN defaults to device title)")
+		cmd.Flags().String("validity", "365d", "Validity of generated certificate, e.g. 90d or 8760h")
+		if cmd.Flags().Lookup("cert-dir") == nil {
+			cmd.Flags().String("cert-dir", "certs", "Directory to write generated certificates and keys to")
+		}
+	}
+}
+
+// readCertificateFile reads the first certificate of PEM file, or DER encoded one
+func readCertificateFile(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse certificate %s: %w", path, err)
+		}
+		return cert, nil
+	}
+
+	if cert, err := x509.ParseCertificate(data); err == nil {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("no certificate found in %s", path)
+}
+
+// readDeviceCertificate reads device certificate PEM, taking the leaf if file has the whole chain (as issued by inf ca issue)
+func readDeviceCertificate(path string) (string, error) {
+	cert, err := readCertificateFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := checkLocalCARevocation(cert); err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})), nil
+}
+
+// pemFingerprint is sha256 of the first certificate DER, same as platform computes
+func pemFingerprint(data string) ([]byte, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no certificate found")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return sum[:], nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// writeCertificate writes <name>.crt and <name>.key to dir with 0600 permissions
+func writeCertificate(dir, name string, certPEM, keyPEM []byte) (crtPath string, keyPath string, err error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+
+	name = unsafeFileNameChars.ReplaceAllString(name, "_")
+	if strings.Trim(name, "._") == "" {
+		return "", "", fmt.Errorf("can't make certificate file name, set device title")
+	}
+	crtPath = filepath.Join(dir, name+".crt")
+	keyPath = filepath.Join(dir, name+".key")
+
+	// O_EXCL so existing keys are never overwritten, files written before the failure are removed
+	var written []string
+	for _, file := range []struct {
+		path string
+		data []byte
+	}{{keyPath, keyPEM}, {crtPath, certPEM}} {
+		f, err := os.OpenFile(file.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			removeFiles(written)
+			return "", "", err
+		}
+		written = append(written, file.path)
+		_, err = f.Write(file.data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			removeFiles(written)
+			return "", "", err
+		}
+	}
+	return crtPath, keyPath, nil
+}
+
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,496 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const CONFIG_API_VERSION = "inf/v1"
+
+// Config is the CLI config document, holding all the contexts
+type Config struct {
+	ApiVersion     string                    `yaml:"apiVersion" json:"apiVersion"`
+	CurrentContext string                    `yaml:"current-context,omitempty" json:"current-context,omitempty"`
+	Contexts       map[string]*ContextConfig `yaml:"contexts" json:"contexts"`
+}
+
+// ContextConfig holds the settings of a single context
+type ContextConfig struct {
+	Host             string     `yaml:"host" json:"host"`
+	Insecure         bool       `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+	TLS              *TLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`
+	User             string     `yaml:"user,omitempty" json:"user,omitempty"`
+	AuthType         string     `yaml:"auth-type,omitempty" json:"auth-type,omitempty"`
+	LDAPProvider     string     `yaml:"ldap-provider,omitempty" json:"ldap-provider,omitempty"`
+	Token            string     `yaml:"token,omitempty" json:"token,omitempty"`
+	CredentialsStore string     `yaml:"credentials-store,omitempty" json:"credentials-store,omitempty"`
+	Namespace        string     `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Output           string     `yaml:"output,omitempty" json:"output,omitempty"`
+}
+
+// TLSConfig holds TLS settings of the context connection
+type TLSConfig struct {
+	// CA is a path to PEM bundle to verify server certificate with instead of system roots
+	CA         string `yaml:"ca,omitempty" json:"ca,omitempty"`
+	ServerName string `yaml:"server-name,omitempty" json:"server-name,omitempty"`
+	SkipVerify bool   `yaml:"skip-verify,omitempty" json:"skip-verify,omitempty"`
+	// Fingerprint is SHA-256 of the server certificate pinned upon first use
+	Fingerprint string `yaml:"fingerprint,omitempty" json:"fingerprint,omitempty"`
+
+	// Client certificate for mutual TLS, either PEM certificate and key or PKCS#12 bundle
+	ClientCert string `yaml:"client-cert,omitempty" json:"client-cert,omitempty"`
+	ClientKey  string `yaml:"client-key,omitempty" json:"client-key,omitempty"`
+	PKCS12     string `yaml:"pkcs12,omitempty" json:"pkcs12,omitempty"`
+}
+
+// ContextConf is the legacy contexts selection file (~/.infinimesh.contexts)
+type ContextConf struct {
+	Selected string `yaml:"selected"`
+}
+
+// infConfig is the Config loaded upon initialization
+var infConfig *Config
+
+func NewConfig() *Config {
+	return &Config{
+		ApiVersion: CONFIG_API_VERSION,
+		Contexts:   make(map[string]*ContextConfig),
+	}
+}
+
+// settings returns context values keyed the same way they're read via viper
+func (c *ContextConfig) settings(name string) map[string]interface{} {
+	settings := map[string]interface{}{
+		"context":    name,
+		"infinimesh": c.Host,
+		"insecure":   c.Insecure,
+		"token":      c.Token,
+		"namespace":  c.Namespace,
+		"output":     c.Output,
+	}
+	if c.TLS != nil {
+		settings["tls"] = map[string]interface{}{
+			"ca":          c.TLS.CA,
+			"server-name": c.TLS.ServerName,
+			"skip-verify": c.TLS.SkipVerify,
+			"fingerprint": c.TLS.Fingerprint,
+			"client-cert": c.TLS.ClientCert,
+			"client-key":  c.TLS.ClientKey,
+			"pkcs12":      c.TLS.PKCS12,
+		}
+	}
+	return settings
+}
+
+// Names returns names of all contexts sorted
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Contexts))
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Current returns name of the currently selected context
+func (c *Config) Current() string {
+	if c.CurrentContext == "" {
+		return "default"
+	}
+	return c.CurrentContext
+}
+
+func configPath() string {
+	if cfgFile != "" {
+		return cfgFile
+	}
+
+	home, err := os.UserHomeDir()
+	cobra.CheckErr(err)
+
+	return filepath.Join(home, ".infinimesh", "config.yaml")
+}
+
+// contextDir is the directory of the context's local files, like the CA
+func contextDir(name string) string {
+	return filepath.Join(filepath.Dir(configPath()), "contexts", name)
+}
+
+// validateContextName fails for names which can't be used as the context directory
+func validateContextName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return usageError{fmt.Errorf("invalid context name %q", name)}
+	}
+	return nil
+}
+
+// ensureNoContextDir fails if local files are left under the context name, so a new context doesn't inherit them
+func ensureNoContextDir(name string) error {
+	if _, err := os.Stat(contextDir(name)); err == nil {
+		return fmt.Errorf("local files of context %s (like the CA) already exist at %s, remove them first", name, contextDir(name))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// moveContextDir moves local files of the context along with it
+func moveContextDir(src, dst string) error {
+	if err := ensureNoContextDir(dst); err != nil {
+		return err
+	}
+	if _, err := os.Stat(contextDir(src)); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(contextDir(dst)), 0700); err != nil {
+		return err
+	}
+	return os.Rename(contextDir(src), contextDir(dst))
+}
+
+// loadConfig reads the config document, migrating legacy layout if there is no document yet
+func loadConfig() (*Config, error) {
+	data, err := os.ReadFile(configPath())
+	if os.IsNotExist(err) {
+		return migrateLegacyConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conf := NewConfig()
+	if err := yaml.Unmarshal(data, conf); err != nil {
+		return nil, fmt.Errorf("can't parse config %s: %w", configPath(), err)
+	}
+
+	if conf.ApiVersion != CONFIG_API_VERSION {
+		return nil, fmt.Errorf("unsupported config apiVersion %q in %s", conf.ApiVersion, configPath())
+	}
+	if conf.Contexts == nil {
+		conf.Contexts = make(map[string]*ContextConfig)
+	}
+
+	return conf, nil
+}
+
+// Save writes the config document, readable only by the owner
+func (c *Config) Save() error {
+	path := configPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	// Written aside and renamed over the config, so the mode applies to already existing, e.g. legacy, config too
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// migrateLegacyConfig builds the config document out of ~/.infinimesh.contexts and ~/.<context>.infinimesh.yaml files
+func migrateLegacyConfig() (*Config, error) {
+	conf := NewConfig()
+	if cfgFile != "" {
+		return conf, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(home, ".*.infinimesh.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return conf, nil
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "."), ".infinimesh.yaml")
+
+		v := viper.New()
+		v.SetConfigType("yaml")
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping legacy context file %s: %v\n", file, err)
+			continue
+		}
+
+		if v.GetString("infinimesh") == "" {
+			continue
+		}
+		if err := validateContextName(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping legacy context file %s: %v\n", file, err)
+			continue
+		}
+
+		conf.Contexts[name] = &ContextConfig{
+			Host:     v.GetString("infinimesh"),
+			Insecure: v.GetBool("insecure"),
+			TLS:      &TLSConfig{SkipVerify: true},
+			Token:    v.GetString("token"),
+		}
+	}
+
+	contexts := ContextConf{}
+	if data, err := os.ReadFile(filepath.Join(home, ".infinimesh.contexts")); err == nil {
+		yaml.Unmarshal(data, &contexts)
+	}
+	conf.CurrentContext = contexts.Selected
+
+	if err := conf.Save(); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Migrated %d context(s) to %s, legacy files can now be removed:\n", len(conf.Contexts), configPath())
+	for _, file := range files {
+		fmt.Fprintf(os.Stderr, "  %s\n", file)
+	}
+	fmt.Fprintf(os.Stderr, "  %s\n", filepath.Join(home, ".infinimesh.contexts"))
+
+	return conf, nil
+}
+
+var configCmd = &cobra.Command{
+	Use:     "config",
+	Aliases: []string{"cfg"},
+	Short:   "Manage infinimesh CLI config document",
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print path to the config document",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(configPath())
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set current context setting",
+	Long: `Set current context setting
+Keys:
+	host - infinimesh API host:port
+	insecure - whether to use plaintext connection (true/false)
+	namespace - default namespace for commands accepting one
+	output - default output format (table, wide, json, yaml, csv, name, jsonpath=..., go-template=...)
+	credentials-store - where to keep the token (plaintext/keyring/file)
+	tls.ca - path to CA bundle to verify server certificate with
+	tls.server-name - server name to verify server certificate against
+	tls.skip-verify - whether to skip server certificate verification (true/false)
+	tls.fingerprint - pinned server certificate SHA-256 fingerprint (empty to pin again upon next use)
+	tls.client-cert - path to PEM client certificate for mutual TLS
+	tls.client-key - path to PEM client private key for mutual TLS
+	tls.pkcs12 - path to PKCS#12 client certificate bundle for mutual TLS
+`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, ok := infConfig.Contexts[infContext]
+		if !ok {
+			return fmt.Errorf("context %s doesn't exist", infContext)
+		}
+
+		key, value := args[0], args[1]
+		switch key {
+		case "host":
+			ctx.Host = value
+		case "insecure":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			ctx.Insecure = b
+		case "namespace":
+			ctx.Namespace = value
+		case "output":
+			if err := validateOutputFormat(value); err != nil {
+				return err
+			}
+			ctx.Output = value
+		case "credentials-store":
+			if value == ctx.CredentialsStore || (value == CREDENTIALS_STORE_PLAINTEXT && ctx.CredentialsStore == "") {
+				break
+			}
+			from, err := makeCredentialStore(ctx)
+			if err != nil {
+				return err
+			}
+			switched := *ctx
+			switched.CredentialsStore = value
+			to, err := makeCredentialStore(&switched)
+			if err != nil {
+				return err
+			}
+			if err := moveToken(from, infContext, to, infContext); err != nil {
+				return err
+			}
+			ctx.CredentialsStore = value
+		case "tls.ca", "tls.server-name", "tls.skip-verify", "tls.fingerprint",
+			"tls.client-cert", "tls.client-key", "tls.pkcs12":
+			if ctx.TLS == nil {
+				ctx.TLS = &TLSConfig{}
+			}
+			switch key {
+			case "tls.ca":
+				ctx.TLS.CA = value
+			case "tls.server-name":
+				ctx.TLS.ServerName = value
+			case "tls.skip-verify":
+				b, err := strconv.ParseBool(value)
+				if err != nil {
+					return err
+				}
+				ctx.TLS.SkipVerify = b
+			case "tls.fingerprint":
+				ctx.TLS.Fingerprint = value
+			case "tls.client-cert":
+				ctx.TLS.ClientCert = value
+			case "tls.client-key":
+				ctx.TLS.ClientKey = value
+			case "tls.pkcs12":
+				ctx.TLS.PKCS12 = value
+			}
+		default:
+			return fmt.Errorf("unknown key %s", key)
+		}
+
+		return infConfig.Save()
+	},
+}
+
+var configExportCmd = &cobra.Command{
+	Use:   "export [context]",
+	Short: "Export context (without token) to share it",
+	Long: `Export context (without token) to share it
+Exports current context if none given. Output is written to stdout unless --file is set.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := infContext
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		ctx, ok := infConfig.Contexts[name]
+		if !ok {
+			return fmt.Errorf("context %s doesn't exist", name)
+		}
+
+		exported := *ctx
+		exported.Token = ""
+		exported.CredentialsStore = ""
+
+		conf := NewConfig()
+		conf.CurrentContext = name
+		conf.Contexts[name] = &exported
+
+		data, err := yaml.Marshal(conf)
+		if err != nil {
+			return err
+		}
+
+		if file, _ := cmd.Flags().GetString("file"); file != "" {
+			return os.WriteFile(file, data, 0600)
+		}
+
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+var configImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import context(s) from exported config document",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		imported := NewConfig()
+		if err := yaml.Unmarshal(data, imported); err != nil {
+			return err
+		}
+		if imported.ApiVersion != CONFIG_API_VERSION {
+			return fmt.Errorf("unsupported config apiVersion %q", imported.ApiVersion)
+		}
+
+		rename, _ := cmd.Flags().GetString("name")
+		if rename != "" && len(imported.Contexts) != 1 {
+			return errors.New("--name can only be used when importing single context")
+		}
+
+		force, _ := cmd.Flags().GetBool("force")
+		for name, ctx := range imported.Contexts {
+			if rename != "" {
+				name = rename
+			}
+			if err := validateContextName(name); err != nil {
+				return err
+			}
+			if _, ok := infConfig.Contexts[name]; ok && !force {
+				return fmt.Errorf("context %s already exists, use --force to overwrite", name)
+			}
+
+			ctx.Token = ""
+			ctx.CredentialsStore = ""
+			infConfig.Contexts[name] = ctx
+			fmt.Printf("Context %s imported\n", name)
+		}
+
+		return infConfig.Save()
+	},
+}
+
+func init() {
+	configExportCmd.Flags().StringP("file", "f", "", "File to write exported context to")
+	configImportCmd.Flags().String("name", "", "Name to import the context as")
+	configImportCmd.Flags().Bool("force", false, "Overwrite existing contexts")
+
+	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configExportCmd)
+	configCmd.AddCommand(configImportCmd)
+
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,153 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Keepalive pings are not sent more often than grpc-go servers permit by default (5m),
+// otherwise server would close the connection with too_many_pings
+const (
+	KEEPALIVE_TIME    = 5 * time.Minute
+	KEEPALIVE_TIMEOUT = 20 * time.Second
+)
+
+// gRPC caps retry attempts at 5, including the original call
+const MAX_RETRIES = 4
+
+var (
+	conn   *grpc.ClientConn
+	connMu sync.Mutex
+)
+
+// makeConnection lazily dials the connection shared by all clients within the run
+func makeConnection(ctx context.Context) (*grpc.ClientConn, error) {
+	connMu.Lock()
+	defer connMu.Unlock()
+
+	if conn != nil {
+		return conn, nil
+	}
+
+	serviceConfig, err := makeServiceConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(reauthInterceptor, timeoutInterceptor),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    KEEPALIVE_TIME,
+			Timeout: KEEPALIVE_TIMEOUT,
+		}),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+	}
+	if insec := viper.GetBool("insecure"); insec {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		config, err := makeTLSConfig(currentTLSConfig(), pinCurrentContext)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	}
+
+	conn, err = grpc.DialContext(ctx, viper.GetString("infinimesh"), opts...)
+	return conn, err
+}
+
+// closeConnection closes the shared connection if it was ever dialed
+func closeConnection() {
+	connMu.Lock()
+	defer connMu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+		conn = nil
+	}
+}
+
+// timeoutInterceptor applies --timeout to unary calls, all retry attempts included
+func timeoutInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	timeout := viper.GetDuration("timeout")
+	if timeout <= 0 {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+type methodConfig struct {
+	Name        []map[string]string `json:"name"`
+	RetryPolicy *retryPolicy        `json:"retryPolicy,omitempty"`
+}
+
+// makeServiceConfig builds gRPC service config applying retry policy to all methods
+func makeServiceConfig() (string, error) {
+	retries := viper.GetInt("retries")
+	if retries > MAX_RETRIES {
+		return "", errors.New("retries can't be more than 4")
+	}
+
+	mc := methodConfig{
+		// Empty name matches all methods of all services
+		Name: []map[string]string{{}},
+	}
+	if retries > 0 {
+		if viper.GetDuration("retry-backoff") <= 0 || viper.GetDuration("retry-max-backoff") <= 0 {
+			return "", errors.New("retry backoff must be positive")
+		}
+		mc.RetryPolicy = &retryPolicy{
+			MaxAttempts:          retries + 1,
+			InitialBackoff:       durationString(viper.GetDuration("retry-backoff")),
+			MaxBackoff:           durationString(viper.GetDuration("retry-max-backoff")),
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE", "RESOURCE_EXHAUSTED"},
+		}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"methodConfig": []methodConfig{mc},
+	})
+	return string(data), err
+}
+
+// durationString formats duration the way service config expects it (seconds with "s" suffix)
+func durationString(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
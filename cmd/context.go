@@ -17,11 +17,14 @@ package cmd
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"runtime"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -33,10 +36,9 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"gopkg.in/yaml.v2"
 
+	hfpb "github.com/infinimesh/proto/handsfree"
 	pb "github.com/infinimesh/proto/node"
-	accpb "github.com/infinimesh/proto/node/accounts"
 	"github.com/infinimesh/proto/node/sessions"
 )
 
@@ -44,10 +46,6 @@ func getVersion() string {
 	return VERSION
 }
 
-type ContextConf struct {
-	Selected string `yaml:"selected"`
-}
-
 // contextCmd represents the context command
 var contextCmd = &cobra.Command{
 	Use:     "context",
@@ -57,8 +55,8 @@ var contextCmd = &cobra.Command{
 		data := make(map[string]interface{})
 		data["version"] = getVersion()
 
-		data["host"] = viper.Get("infinimesh")
-		if data["host"] == nil {
+		data["host"] = viper.GetString("infinimesh")
+		if data["host"] == "" {
 			data = map[string]interface{}{
 				"error": "No infinimesh context found",
 			}
@@ -72,6 +70,16 @@ var contextCmd = &cobra.Command{
 			data["context"] = viper.GetString("context")
 		}
 
+		if token, _ := loadToken(); token != "" {
+			data["expires"] = "Never"
+			if exp, err := tokenExpires(token); err == nil {
+				data["expires"] = exp.Format(time.RFC1123)
+				if time.Now().After(exp) {
+					data["expires"] = exp.Format(time.RFC1123) + " (expired)"
+				}
+			}
+		}
+
 		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
 			return printJsonResponse(data)
 		}
@@ -90,105 +98,446 @@ var setContextCmd = &cobra.Command{
 	Short: "Set infinimesh CLI Context",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		home, err := os.UserHomeDir()
-		cobra.CheckErr(err)
+		if _, ok := infConfig.Contexts[args[0]]; !ok {
+			if create, _ := cmd.Flags().GetBool("create"); !create {
+				return fmt.Errorf("context %s doesn't exist, use --create to create it", args[0])
+			}
+			if err := validateContextName(args[0]); err != nil {
+				return err
+			}
+			infConfig.Contexts[args[0]] = &ContextConfig{}
+		}
+
+		infConfig.CurrentContext = args[0]
+		return infConfig.Save()
+	},
+}
+
+var listContextsCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls", "l"},
+	Short:   "List infinimesh CLI Contexts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pool := make([]map[string]interface{}, 0, len(infConfig.Contexts))
+		for _, name := range infConfig.Names() {
+			pool = append(pool, describeContext(name))
+		}
+
+		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
+			return printJsonResponse(pool)
+		}
+
+		PrintContexts(pool)
+		return nil
+	},
+}
+
+var showContextCmd = &cobra.Command{
+	Use:   "show <context>",
+	Short: "Print infinimesh CLI Context by name",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, ok := infConfig.Contexts[args[0]]; !ok {
+			return fmt.Errorf("context %s doesn't exist", args[0])
+		}
 
-		profilesCfg := fmt.Sprintf("%s/.infinimesh.contexts", home)
+		data := describeContext(args[0])
+		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
+			return printJsonResponse(data)
+		}
 
-		if _, err := os.Stat(profilesCfg); os.IsNotExist(err) {
-			if _, err := os.Create(profilesCfg); err != nil { // perm 0666
-				fmt.Fprintln(os.Stderr, "Can't create default contexts config file")
-				panic(err)
+		caser := cases.Title(language.English)
+		for _, k := range []string{"name", "host", "insecure", "namespace", "output", "store", "expires", "current"} {
+			fmt.Printf("%s: %v\n", caser.String(k), data[k])
+		}
+		return nil
+	},
+}
+
+var deleteContextCmd = &cobra.Command{
+	Use:     "delete <context>",
+	Aliases: []string{"del", "rm", "remove"},
+	Short:   "Delete infinimesh CLI Context",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, ok := infConfig.Contexts[args[0]]
+		if !ok {
+			return fmt.Errorf("context %s doesn't exist", args[0])
+		}
+		store, err := makeCredentialStore(ctx)
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(args[0]); err != nil {
+			return err
+		}
+		// Otherwise context created later with the same name would inherit the CA key
+		if _, err := os.Stat(contextDir(args[0])); err == nil {
+			if err := os.RemoveAll(contextDir(args[0])); err != nil {
+				return err
 			}
+			fmt.Printf("Removed local files of the context (like the CA) at %s\n", contextDir(args[0]))
 		}
+		delete(infConfig.Contexts, args[0])
 
-		contexts := ContextConf{
-			Selected: args[0],
+		if args[0] == infConfig.Current() {
+			fmt.Printf("Context %s was selected, switching to default\n", args[0])
+			infConfig.CurrentContext = ""
 		}
-		r, _ := yaml.Marshal(contexts)
-		return os.WriteFile(profilesCfg, r, 0640)
+		return infConfig.Save()
 	},
 }
 
-var loginCmd = &cobra.Command{
-	Use:     "login <host:port> <login>",
-	Aliases: []string{"l", "auth", "a"},
+var renameContextCmd = &cobra.Command{
+	Use:     "rename <context> <new-name>",
+	Aliases: []string{"mv"},
+	Short:   "Rename infinimesh CLI Context",
 	Args:    cobra.ExactArgs(2),
-	Short:   "Authorize in infinimesh and store credentials",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		creds := credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
-		insec, _ := cmd.Flags().GetBool("insecure")
-		if insec {
-			creds = insecure.NewCredentials()
+		if err := copyContext(args[0], args[1]); err != nil {
+			return err
 		}
-		conn, err := grpc.Dial(args[0], grpc.WithTransportCredentials(creds))
+		store, err := makeCredentialStore(infConfig.Contexts[args[0]])
 		if err != nil {
 			return err
 		}
+		if err := moveContextDir(args[0], args[1]); err != nil {
+			return err
+		}
+		if err := moveToken(store, args[0], store, args[1]); err != nil {
+			moveContextDir(args[1], args[0])
+			return err
+		}
+		delete(infConfig.Contexts, args[0])
 
-		client := pb.NewAccountsServiceClient(conn)
+		if args[0] == infConfig.Current() {
+			infConfig.CurrentContext = args[1]
+		}
+		return infConfig.Save()
+	},
+}
 
-		t := "standard"
-		if ok, err := cmd.Flags().GetBool("ldap"); err != nil {
+var copyContextCmd = &cobra.Command{
+	Use:     "copy <context> <new-name>",
+	Aliases: []string{"cp"},
+	Short:   "Copy infinimesh CLI Context",
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := copyContext(args[0], args[1]); err != nil {
+			return err
+		}
+		// Local CA isn't copied, as both copies would issue certificates with the same serials
+		if err := ensureNoContextDir(args[1]); err != nil {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(contextDir(args[0]), "ca")); err == nil {
+			fmt.Printf("Local CA of %s isn't copied, run inf ca init --context %s to make a new one\n", args[0], args[1])
+		}
+		store, err := makeCredentialStore(infConfig.Contexts[args[0]])
+		if err != nil {
+			return err
+		}
+		if token, err := store.Get(args[0]); err != nil {
 			return err
-		} else if ok {
-			t = "ldap"
+		} else if token != "" {
+			if err := store.Set(args[1], token); err != nil {
+				return err
+			}
 		}
+		return infConfig.Save()
+	},
+}
 
-		var password string
-		if p, _ := cmd.Flags().GetString("password"); p != "" {
-			password = p
+func describeContext(name string) map[string]interface{} {
+	ctx := infConfig.Contexts[name]
+	data := map[string]interface{}{
+		"name":      name,
+		"host":      ctx.Host,
+		"insecure":  ctx.Insecure,
+		"namespace": ctx.Namespace,
+		"output":    ctx.Output,
+		"store":     ctx.CredentialsStore,
+		"expires":   "-",
+		"current":   name == infConfig.Current(),
+	}
+	if ctx.CredentialsStore == "" {
+		data["store"] = CREDENTIALS_STORE_PLAINTEXT
+	}
+
+	// Encrypted file store would require passphrase, so it's not peeked into
+	if ctx.CredentialsStore == CREDENTIALS_STORE_FILE {
+		data["expires"] = "Encrypted"
+		return data
+	}
+
+	var token string
+	if store, err := makeCredentialStore(ctx); err == nil {
+		token, _ = store.Get(name)
+	}
+	if token != "" {
+		if exp, err := tokenExpires(token); err == nil {
+			data["expires"] = exp.Format(time.RFC1123)
 		} else {
+			data["expires"] = "Never"
+		}
+	}
 
-			prompt := promptui.Prompt{
-				Label: "Password",
-				Mask:  '*',
-			}
+	return data
+}
 
-			password, err = prompt.Run()
-			if err != nil {
+func copyContext(src, dst string) error {
+	ctx, ok := infConfig.Contexts[src]
+	if !ok {
+		return fmt.Errorf("context %s doesn't exist", src)
+	}
+	if _, ok := infConfig.Contexts[dst]; ok {
+		return fmt.Errorf("context %s already exists", dst)
+	}
+	if err := validateContextName(dst); err != nil {
+		return err
+	}
+
+	copied := *ctx
+	if ctx.TLS != nil {
+		tls := *ctx.TLS
+		copied.TLS = &tls
+	}
+	infConfig.Contexts[dst] = &copied
+	return nil
+}
+
+func PrintContexts(pool []map[string]interface{}) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"", "Name", "Host", "Insecure", "Token Expires"})
+
+	rows := make([]table.Row, len(pool))
+	for i, ctx := range pool {
+		current := ""
+		if ctx["current"].(bool) {
+			current = "*"
+		}
+		rows[i] = table.Row{current, ctx["name"], ctx["host"], ctx["insecure"], ctx["expires"]}
+	}
+	t.AppendRows(rows)
+
+	t.AppendFooter(table.Row{"", "", "", "Total Found", len(pool)})
+	t.Render()
+}
+
+var loginCmd = &cobra.Command{
+	Use:     "login <host:port> [login]",
+	Aliases: []string{"l", "auth", "a"},
+	Args: cobra.MatchAll(cobra.RangeArgs(1, 2), func(cmd *cobra.Command, args []string) error {
+		if hf, _ := cmd.Flags().GetBool("handsfree"); !hf && len(args) < 2 {
+			return errors.New("login is required unless --handsfree is used")
+		}
+		return nil
+	}),
+	Short: "Authorize in infinimesh and store credentials",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, ok := infConfig.Contexts[infContext]
+		if !ok {
+			if err := validateContextName(infContext); err != nil {
 				return err
 			}
+			ctx = &ContextConfig{}
 		}
 
-		hostname, err := os.Hostname()
-		if err != nil {
-			hostname = "unknown"
+		// Stored TLS settings are kept on re-login, only the given flags override them
+		tlsConf := &TLSConfig{}
+		if ctx.TLS != nil {
+			*tlsConf = *ctx.TLS
 		}
-
-		client_id := fmt.Sprintf("CLI | %s | %s", hostname, runtime.GOOS)
-		req := &pb.TokenRequest{
-			Auth: &accpb.Credentials{
-				Type: t, Data: []string{args[1], password},
-			},
-			Client: &client_id,
+		for flag, path := range map[string]*string{
+			"ca":          &tlsConf.CA,
+			"client-cert": &tlsConf.ClientCert,
+			"client-key":  &tlsConf.ClientKey,
+			"pkcs12":      &tlsConf.PKCS12,
+		} {
+			if !cmd.Flags().Changed(flag) {
+				continue
+			}
+			p, _ := cmd.Flags().GetString(flag)
+			if p != "" {
+				abs, err := filepath.Abs(p)
+				if err != nil {
+					return err
+				}
+				p = abs
+			}
+			*path = p
+		}
+		// Client certificate is either PEM pair or PKCS#12 bundle, the one given replaces the other
+		if cmd.Flags().Changed("pkcs12") && !cmd.Flags().Changed("client-cert") {
+			tlsConf.ClientCert, tlsConf.ClientKey = "", ""
+		} else if cmd.Flags().Changed("client-cert") && !cmd.Flags().Changed("pkcs12") {
+			tlsConf.PKCS12 = ""
+		}
+		if cmd.Flags().Changed("server-name") {
+			tlsConf.ServerName, _ = cmd.Flags().GetString("server-name")
+		}
+		if cmd.Flags().Changed("tls-skip-verify") {
+			tlsConf.SkipVerify, _ = cmd.Flags().GetBool("tls-skip-verify")
+		}
+		// Keep pinned certificate as long as it's the same host
+		if ctx.Host != args[0] {
+			tlsConf.Fingerprint = ""
 		}
 
-		res, err := client.Token(context.Background(), req)
+		insec, _ := cmd.Flags().GetBool("insecure")
+		var creds credentials.TransportCredentials
+		if insec {
+			creds = insecure.NewCredentials()
+		} else {
+			config, err := makeTLSConfig(tlsConf, func(fingerprint string) {
+				fmt.Fprintf(os.Stderr, "Pinned server certificate with fingerprint %s\n", fingerprint)
+			})
+			if err != nil {
+				return err
+			}
+			creds = credentials.NewTLS(config)
+		}
+		conn, err := grpc.Dial(args[0], grpc.WithTransportCredentials(creds), grpc.WithUnaryInterceptor(timeoutInterceptor))
 		if err != nil {
 			return err
 		}
-		token := res.GetToken()
+		defer conn.Close()
+
+		var token, t, login, ldapProvider string
+		if hf, _ := cmd.Flags().GetBool("handsfree"); hf {
+			t = "handsfree"
+			qr, _ := cmd.Flags().GetBool("qr")
+			timeout, _ := cmd.Flags().GetDuration("handsfree-timeout")
+
+			hfCtx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			token, err = handsfreeToken(hfCtx, hfpb.NewHandsfreeServiceClient(conn), qr)
+			if err != nil {
+				return err
+			}
+		} else {
+			login = args[1]
+			token, t, ldapProvider, err = passwordToken(cmd, conn, login)
+			if err != nil {
+				return err
+			}
+		}
+
 		printToken, _ := cmd.Flags().GetBool("print-token")
 		if printToken {
 			fmt.Println(token)
 		}
 
-		infContext := "default"
-		if ctx, _ := cmd.Flags().GetString("context"); ctx != "" {
-			infContext = ctx
+		if noSave, _ := cmd.Flags().GetBool("no-save"); noSave {
+			return nil
 		}
 
-		viper.Set("infinimesh", args[0])
-		viper.Set("token", token)
-		viper.Set("insecure", insec)
-		viper.Set("context", infContext)
+		infConfig.Contexts[infContext] = ctx
+		ctx.Host = args[0]
+		ctx.TLS = tlsConf
+		ctx.Insecure = insec
+		ctx.User = login
+		ctx.AuthType = t
+		ctx.LDAPProvider = ldapProvider
+
+		if cs, _ := cmd.Flags().GetString("credentials-store"); cs != "" && cs != ctx.CredentialsStore {
+			// Remove token from previously used store
+			if store, err := makeCredentialStore(ctx); err == nil {
+				store.Delete(infContext)
+			}
+			ctx.CredentialsStore = cs
+		}
 
-		err = viper.WriteConfig()
-		return err
+		if infConfig.CurrentContext == "" {
+			infConfig.CurrentContext = infContext
+		}
+
+		return saveToken(ctx, token)
 	},
 }
 
+// passwordToken asks for password if needed and exchanges standard or LDAP credentials for the token
+func passwordToken(cmd *cobra.Command, conn *grpc.ClientConn, login string) (token, t, ldapProvider string, err error) {
+	t = "standard"
+	ldapProvider, _ = cmd.Flags().GetString("ldap-provider")
+	if ok, err := cmd.Flags().GetBool("ldap"); err != nil {
+		return "", "", "", err
+	} else if ok || ldapProvider != "" {
+		t = "ldap"
+	}
+
+	if t == "ldap" && ldapProvider == "" {
+		ldapProvider, err = selectLDAPProvider(pb.NewInternalServiceClient(conn))
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+
+	var password string
+	if p, _ := cmd.Flags().GetString("password"); p != "" {
+		password = p
+	} else if stdin, _ := cmd.Flags().GetBool("password-stdin"); stdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", "", "", err
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	} else {
+		prompt := promptui.Prompt{
+			Label: "Password",
+			Mask:  '*',
+		}
+
+		password, err = prompt.Run()
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+
+	token, err = requestToken(context.Background(), pb.NewAccountsServiceClient(conn), makeCredentials(t, login, password, ldapProvider))
+	return token, t, ldapProvider, err
+}
+
+// selectLDAPProvider fetches LDAP Providers and lets user choose one if there are several
+func selectLDAPProvider(client pb.InternalServiceClient) (string, error) {
+	r, err := client.GetLDAPProviders(context.Background(), &pb.EmptyMessage{})
+	if err != nil {
+		return "", fmt.Errorf("can't get LDAP Providers: %w", err)
+	}
+
+	providers := r.GetProviders()
+	keys := make([]string, 0, len(providers))
+	for key := range providers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	switch {
+	case len(keys) == 0:
+		return "", errors.New("no LDAP Providers registered")
+	case len(keys) == 1:
+		return keys[0], nil
+	case !isInteractive():
+		return "", fmt.Errorf("several LDAP Providers registered, choose one with --ldap-provider: %s", strings.Join(keys, ", "))
+	}
+
+	items := make([]string, len(keys))
+	for i, key := range keys {
+		items[i] = fmt.Sprintf("%s (%s)", providers[key], key)
+	}
+
+	prompt := promptui.Select{
+		Label: "LDAP Provider",
+		Items: items,
+	}
+	i, _, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+	return keys[i], nil
+}
+
 // make SessionsServiceClient
 func makeSessionsServiceClient(ctx context.Context) (pb.SessionsServiceClient, error) {
 	conn, err := makeConnection(ctx)
@@ -208,28 +557,28 @@ var sessionsCmd = &cobra.Command{
 			return err
 		}
 
-		sess, err := client.Get(ctx, &pb.EmptyMessage{})
-		if err != nil {
-			return err
-		}
+		withActivity, _ := cmd.Flags().GetBool("with-activity")
+		withActivity = withActivity || outputFormat(cmd) == OUTPUT_WIDE
 
-		var act *sessions.Activity
-		if wa, _ := cmd.Flags().GetBool("with-activity"); wa {
-			act, err = client.GetActivity(ctx, &pb.EmptyMessage{})
+		return printList(cmd, func() (interface{}, *Table, error) {
+			sess, err := client.Get(ctx, &pb.EmptyMessage{})
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
-		}
 
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(map[string]interface{}{
+			var act *sessions.Activity
+			if withActivity {
+				act, err = client.GetActivity(ctx, &pb.EmptyMessage{})
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+
+			return map[string]interface{}{
 				"sessions": sess.GetSessions(),
 				"activity": act.GetLastSeen(),
-			})
-		}
-
-		PrintSessions(sess.GetSessions(), act)
-		return nil
+			}, sessionsTable(sess.GetSessions(), act).ListedIn("sessions"), nil
+		})
 	},
 }
 
@@ -258,53 +607,44 @@ var sessionRevokeCmd = &cobra.Command{
 	},
 }
 
-func PrintSessions(pool []*sessions.Session, act *sessions.Activity) {
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-
-	header := []interface{}{"ID", "Client", "Created", "Expires"}
-	if act != nil {
-		header = append(header, "Last Seen")
+func sessionsTable(pool []*sessions.Session, act *sessions.Activity) *Table {
+	columns := []Column[*sessions.Session]{
+		{Name: "ID", Value: func(sess *sessions.Session) interface{} { return sess.GetId() }},
+		{Name: "Client", Value: func(sess *sessions.Session) interface{} {
+			if sess.GetClient() == "" {
+				return "N/A"
+			}
+			return sess.GetClient()
+		}},
+		{Name: "Created", Value: func(sess *sessions.Session) interface{} {
+			return sess.GetCreated().AsTime().Format(time.RFC1123)
+		}},
+		{Name: "Expires", Value: func(sess *sessions.Session) interface{} {
+			if sess.GetExpires() == nil {
+				return "Never"
+			}
+			return sess.GetExpires().AsTime().Format(time.RFC1123)
+		}},
 	}
-	t.AppendHeader(header)
-
-	rows := make([]table.Row, len(pool))
-	for i, sess := range pool {
-		client := sess.GetClient()
-		if client == "" {
-			client = "N/A"
-		}
-
-		expires := sess.GetExpires().AsTime().Format(time.RFC1123)
-		if sess.GetExpires() == nil {
-			expires = "Never"
-		}
-
-		rows[i] = table.Row{sess.GetId(), client, sess.GetCreated().AsTime().Format(time.RFC1123), expires}
-
-		if act != nil {
-			last_seen := "Never"
+	if act != nil {
+		columns = append(columns, Column[*sessions.Session]{Name: "Last Seen", Value: func(sess *sessions.Session) interface{} {
 			if ts, ok := act.GetLastSeen()[sess.GetId()]; ok {
-				last_seen = ts.AsTime().Format(time.RFC1123)
+				return ts.AsTime().Format(time.RFC1123)
 			}
-
-			rows[i] = append(rows[i], last_seen)
-		}
-
+			return "Never"
+		}})
+	}
+	columns = append(columns, Column[*sessions.Session]{Name: "Current", Value: func(sess *sessions.Session) interface{} {
 		if sess.GetCurrent() {
-			rows[i] = append(rows[i], "Current")
+			return "Current"
 		}
-	}
+		return ""
+	}})
 
-	t.AppendRows(rows)
-
-	t.SortBy([]table.SortBy{
-		{Name: "Expires", Mode: table.Asc},
-		{Name: "Created", Mode: table.Dsc},
-	})
-
-	t.AppendFooter(table.Row{"", "", "Total Found", len(pool)})
-	t.Render()
+	return NewTable("session", pool, (*sessions.Session).GetId, columns...).Sort(
+		table.SortBy{Name: "Expires", Mode: table.Asc},
+		table.SortBy{Name: "Created", Mode: table.Dsc},
+	)
 }
 
 var versionCmd = &cobra.Command{
@@ -329,11 +669,32 @@ var versionCmd = &cobra.Command{
 
 func init() {
 	loginCmd.Flags().StringP("password", "p", "", "Password for Standard Credentials")
-	loginCmd.Flags().Bool("print-token", false, "")
+	loginCmd.Flags().Bool("password-stdin", false, "Read password from stdin")
+	loginCmd.MarkFlagsMutuallyExclusive("password", "password-stdin")
+	loginCmd.Flags().Bool("print-token", false, "Print token")
+	loginCmd.Flags().Bool("no-save", false, "Don't store context and token (use with --print-token)")
 	loginCmd.Flags().Bool("insecure", false, "Use WithInsecure instead of TLS")
+	loginCmd.Flags().String("ca", "", "Path to CA bundle to verify server certificate with (defaults to system roots)")
+	loginCmd.Flags().String("server-name", "", "Server name to verify server certificate against (defaults to host)")
+	loginCmd.Flags().Bool("tls-skip-verify", false, "Skip server certificate verification (pinned fingerprint is still checked)")
+	loginCmd.Flags().String("client-cert", "", "Path to PEM client certificate for mutual TLS")
+	loginCmd.Flags().String("client-key", "", "Path to PEM client private key for mutual TLS")
+	loginCmd.Flags().String("pkcs12", "", "Path to PKCS#12 client certificate bundle for mutual TLS (password is read from INF_PKCS12_PASSWORD or asked)")
 	loginCmd.Flags().Bool("ldap", false, "Use Credentials Type LDAP")
-
+	loginCmd.Flags().String("ldap-provider", "", "LDAP Provider Key (implies --ldap, asked if not given and there are several)")
+	loginCmd.Flags().Bool("handsfree", false, "Login without password, by approving the code from already authenticated device or Console")
+	loginCmd.Flags().Bool("qr", false, "Show Handsfree code as QR code too")
+	loginCmd.Flags().Duration("handsfree-timeout", HANDSFREE_TIMEOUT, "How long to wait for Handsfree code approval")
+	loginCmd.Flags().String("credentials-store", "", "Where to store the token: plaintext, keyring or file (defaults to context setting or plaintext)")
+
+	contextCmd.AddCommand(listContextsCmd)
+	contextCmd.AddCommand(showContextCmd)
+	contextCmd.AddCommand(deleteContextCmd)
+	contextCmd.AddCommand(renameContextCmd)
+	contextCmd.AddCommand(copyContextCmd)
 	rootCmd.AddCommand(contextCmd)
+
+	setContextCmd.Flags().Bool("create", false, "Create Context if it doesn't exist")
 	rootCmd.AddCommand(setContextCmd)
 	rootCmd.AddCommand(loginCmd)
 	rootCmd.AddCommand(versionCmd)
@@ -341,5 +702,7 @@ func init() {
 	sessionsCmd.AddCommand(sessionRevokeCmd)
 
 	sessionsCmd.Flags().BoolP("with-activity", "a", false, "Show Activity")
+	addListFlags(sessionsCmd)
+	addWatchFlags(sessionsCmd)
 	rootCmd.AddCommand(sessionsCmd)
 }
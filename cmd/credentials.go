@@ -0,0 +1,377 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	CREDENTIALS_STORE_PLAINTEXT = "plaintext"
+	CREDENTIALS_STORE_KEYRING   = "keyring"
+	CREDENTIALS_STORE_FILE      = "file"
+)
+
+const KEYRING_SERVICE = "infinimesh-cli"
+
+// CredentialStore keeps the bearer tokens of contexts
+type CredentialStore interface {
+	Get(context string) (string, error)
+	Set(context, token string) error
+	Delete(context string) error
+}
+
+// makeCredentialStore returns the CredentialStore configured for the given context
+func makeCredentialStore(ctx *ContextConfig) (CredentialStore, error) {
+	switch ctx.CredentialsStore {
+	case "", CREDENTIALS_STORE_PLAINTEXT:
+		return &plaintextStore{conf: infConfig}, nil
+	case CREDENTIALS_STORE_KEYRING:
+		return &keyringStore{}, nil
+	case CREDENTIALS_STORE_FILE:
+		return &encryptedFileStore{dir: filepath.Join(filepath.Dir(configPath()), "credentials")}, nil
+	default:
+		return nil, fmt.Errorf("unknown credentials store %q", ctx.CredentialsStore)
+	}
+}
+
+// cachedToken is kept, so the store is accessed(and passphrase is asked) only once per run
+var cachedToken *string
+
+// loadToken returns the bearer token, either from --token-file, INF_TOKEN or the current context
+func loadToken() (string, error) {
+	if cachedToken != nil {
+		return *cachedToken, nil
+	}
+
+	if file := viper.GetString("token-file"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("can't read token file: %w", err)
+		}
+		t := strings.TrimSpace(string(data))
+		cachedToken = &t
+		warnTokenExpiry(t)
+		return t, nil
+	}
+
+	if t := viper.GetString("token"); t != "" {
+		cachedToken = &t
+		warnTokenExpiry(t)
+		return t, nil
+	}
+
+	ctx, ok := infConfig.Contexts[infContext]
+	if !ok {
+		return "", nil
+	}
+
+	store, err := makeCredentialStore(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	t, err := store.Get(infContext)
+	if err != nil {
+		return "", err
+	}
+	cachedToken = &t
+	warnTokenExpiry(t)
+	return t, nil
+}
+
+// moveToken moves the token of context between stores
+func moveToken(from CredentialStore, fromContext string, to CredentialStore, toContext string) error {
+	t, err := from.Get(fromContext)
+	if err != nil {
+		return err
+	}
+	if t != "" {
+		// Token is deleted from the source only once it's stored, so failed write doesn't lose it
+		if err := to.Set(toContext, t); err != nil {
+			return err
+		}
+	}
+	return from.Delete(fromContext)
+}
+
+// plaintextStore keeps tokens in the config document as is
+type plaintextStore struct {
+	conf *Config
+}
+
+func (s *plaintextStore) Get(context string) (string, error) {
+	ctx, ok := s.conf.Contexts[context]
+	if !ok {
+		return "", nil
+	}
+	return ctx.Token, nil
+}
+
+func (s *plaintextStore) Set(context, token string) error {
+	ctx, ok := s.conf.Contexts[context]
+	if !ok {
+		return fmt.Errorf("context %s doesn't exist", context)
+	}
+	ctx.Token = token
+	return nil
+}
+
+func (s *plaintextStore) Delete(context string) error {
+	if ctx, ok := s.conf.Contexts[context]; ok {
+		ctx.Token = ""
+	}
+	return nil
+}
+
+// keyringStore keeps tokens in the OS keyring, Secret Service on Linux and Keychain on macOS
+type keyringStore struct{}
+
+func (s *keyringStore) Get(context string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command("secret-tool", "lookup", "service", KEYRING_SERVICE, "context", context)
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", KEYRING_SERVICE, "-a", context, "-w")
+	default:
+		return "", fmt.Errorf("keyring is not supported on %s", runtime.GOOS)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && keyringNotFound(exitErr) {
+			// No secret stored for the context
+			return "", nil
+		}
+		return "", fmt.Errorf("can't read token from keyring: %w %s", err, keyringStderr(err))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// keyringNotFound tells whether the tool failed only because there is no such secret:
+// secret-tool exits with 1 silently, security exits with errSecItemNotFound(44)
+func keyringNotFound(err *exec.ExitError) bool {
+	switch runtime.GOOS {
+	case "darwin":
+		return err.ExitCode() == 44
+	default:
+		return err.ExitCode() == 1 && len(bytes.TrimSpace(err.Stderr)) == 0
+	}
+}
+
+func keyringStderr(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return strings.TrimSpace(string(exitErr.Stderr))
+	}
+	return ""
+}
+
+func (s *keyringStore) Set(context, token string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command("secret-tool", "store", "--label", "infinimesh CLI token ("+context+")",
+			"service", KEYRING_SERVICE, "context", context)
+		cmd.Stdin = strings.NewReader(token)
+	case "darwin":
+		// Interactive mode reads the command from stdin, so the token doesn't show up in ps
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+			securityQuote(KEYRING_SERVICE), securityQuote(context), securityQuote(token)))
+	default:
+		return fmt.Errorf("keyring is not supported on %s", runtime.GOOS)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("can't store token in keyring: %w %s", err, out)
+	}
+	return nil
+}
+
+// securityQuote quotes argument for security interactive mode
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (s *keyringStore) Delete(context string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		cmd = exec.Command("secret-tool", "clear", "service", KEYRING_SERVICE, "context", context)
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", KEYRING_SERVICE, "-a", context)
+	default:
+		return fmt.Errorf("keyring is not supported on %s", runtime.GOOS)
+	}
+
+	// Deleting missing secret is not an error
+	cmd.Run()
+	return nil
+}
+
+const (
+	ENCRYPTED_FILE_MAGIC  = "INFC1"
+	PBKDF2_ITERATIONS     = 310000
+	ENCRYPTED_SALT_LENGTH = 16
+)
+
+// encryptedFileStore keeps tokens in files encrypted with AES-GCM using passphrase derived key
+type encryptedFileStore struct {
+	dir string
+}
+
+// cachedPassphrase is kept, so it's asked only once per run
+var cachedPassphrase string
+
+func credentialsPassphrase(confirm bool) (string, error) {
+	if cachedPassphrase != "" {
+		return cachedPassphrase, nil
+	}
+	if p := os.Getenv("INF_CREDENTIALS_PASSPHRASE"); p != "" {
+		cachedPassphrase = p
+		return p, nil
+	}
+
+	prompt := promptui.Prompt{
+		Label: "Credentials Passphrase",
+		Mask:  '*',
+	}
+	p, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+
+	if confirm {
+		prompt.Label = "Repeat Passphrase"
+		repeat, err := prompt.Run()
+		if err != nil {
+			return "", err
+		}
+		if repeat != p {
+			return "", errors.New("passphrases don't match")
+		}
+	}
+
+	cachedPassphrase = p
+	return p, nil
+}
+
+func (s *encryptedFileStore) path(context string) string {
+	return filepath.Join(s.dir, context+".enc")
+}
+
+func (s *encryptedFileStore) Get(context string) (string, error) {
+	data, err := os.ReadFile(s.path(context))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !bytes.HasPrefix(data, []byte(ENCRYPTED_FILE_MAGIC)) {
+		return "", fmt.Errorf("%s is not an encrypted credentials file", s.path(context))
+	}
+	data = data[len(ENCRYPTED_FILE_MAGIC):]
+	if len(data) < ENCRYPTED_SALT_LENGTH {
+		return "", errors.New("encrypted credentials file is corrupted")
+	}
+	salt, data := data[:ENCRYPTED_SALT_LENGTH], data[ENCRYPTED_SALT_LENGTH:]
+
+	pass, err := credentialsPassphrase(false)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := makeAEAD(pass, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("encrypted credentials file is corrupted")
+	}
+	nonce, data := data[:aead.NonceSize()], data[aead.NonceSize():]
+
+	plain, err := aead.Open(nil, nonce, data, []byte(context))
+	if err != nil {
+		return "", errors.New("can't decrypt credentials, wrong passphrase?")
+	}
+	return string(plain), nil
+}
+
+func (s *encryptedFileStore) Set(context, token string) error {
+	_, err := os.Stat(s.path(context))
+	pass, err := credentialsPassphrase(os.IsNotExist(err) && cachedPassphrase == "")
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, ENCRYPTED_SALT_LENGTH)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	aead, err := makeAEAD(pass, salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data := append([]byte(ENCRYPTED_FILE_MAGIC), salt...)
+	data = append(data, nonce...)
+	data = aead.Seal(data, nonce, []byte(token), []byte(context))
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(context), data, 0600)
+}
+
+func (s *encryptedFileStore) Delete(context string) error {
+	err := os.Remove(s.path(context))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func makeAEAD(pass string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(pass), salt, PBKDF2_ITERATIONS, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
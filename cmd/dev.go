@@ -69,7 +69,7 @@ var genUIPluginUrlCmd = &cobra.Command{
 
 		token, _ := cmd.Flags().GetString("token")
 		if token == "" {
-			token = viper.GetString("token")
+			token, _ = loadToken()
 			if token == "" {
 				fmt.Println("[WARN] No token is given or found in CLI store, using placeholder!")
 				token = "aSBhbSBub3QgYQ.SldUIHRva2Vu.anVzdCBob2xkaW5nIHBsYWNlIGhlcmU"
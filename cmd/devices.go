@@ -16,15 +16,25 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/infinimesh/proto/node/access"
 
@@ -32,11 +42,19 @@ import (
 	"github.com/infinimesh/infinimesh/pkg/convert"
 	pb "github.com/infinimesh/proto/node"
 	devpb "github.com/infinimesh/proto/node/devices"
+	nspb "github.com/infinimesh/proto/node/namespaces"
 	shadowpb "github.com/infinimesh/proto/shadow"
 	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -76,21 +94,35 @@ var listDevicesCmd = &cobra.Command{
 		}
 
 		req := &pb.QueryRequest{}
-		if ns, err := cmd.Flags().GetString("ns"); err != nil && ns != "" {
+		ns, _ := cmd.Flags().GetString("ns")
+		if ns == "" {
+			ns = viper.GetString("namespace")
+		}
+		if ns != "" {
 			req.Namespace = &ns
 		}
 
-		r, err := client.List(ctx, req)
+		sel, err := commandSelector(cmd)
 		if err != nil {
 			return err
 		}
 
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
-		}
-
-		PrintDevicesPool(r.Devices)
-		return nil
+		return printList(cmd, func() (interface{}, *Table, error) {
+			r, err := client.List(ctx, req)
+			if err != nil {
+				return nil, nil, err
+			}
+			if sel != nil {
+				var pool []*devpb.Device
+				for _, dev := range r.Devices {
+					if sel.Match(dev) {
+						pool = append(pool, dev)
+					}
+				}
+				r = &devpb.Devices{Devices: pool, Total: int64(len(pool))}
+			}
+			return r, devicesTable(r.Devices).ListedIn("devices"), nil
+		})
 	},
 }
 
@@ -109,86 +141,148 @@ var getDeviceCmd = &cobra.Command{
 			return err
 		}
 
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
+		if outputFormat(cmd) == OUTPUT_TABLE {
+			PrintSingleDevice(r)
+			return nil
 		}
-
-		PrintSingleDevice(r)
-		return nil
+		return printOutput(cmd, r, devicesTable([]*devpb.Device{r}))
 	},
 }
 
 var toggleDeviceCmd = &cobra.Command{
-	Use:   "toggle",
+	Use:   "toggle [uuid...]",
 	Short: "Toggle infinimesh device (enabled/disabled)",
+	Long: `Toggle infinimesh devices given by UUIDs and/or selected with --selector (enabled/disabled).
+With --enable or --disable devices are set to the given state, ones already in it are skipped.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !hasSelector(cmd) {
+			return usageError{errors.New("no devices given, pass UUIDs or --selector")}
+		}
+
 		ctx := makeContextWithBearerToken()
 		client, err := makeDevicesServiceClient(ctx)
 		if err != nil {
 			return err
 		}
 
-		r, err := client.Get(ctx, &devpb.Device{Uuid: args[0]})
-		if err != nil {
-			return err
+		// Device is left as is if it's in the wanted state already
+		skip := func(dev *devpb.Device) bool {
+			enable, _ := cmd.Flags().GetBool("enable")
+			disable, _ := cmd.Flags().GetBool("disable")
+			return (enable && dev.Enabled) || (disable && !dev.Enabled)
+		}
+		dry, _ := cmd.Flags().GetBool("dry-run")
+
+		if len(args) == 1 && !hasSelector(cmd) {
+			r, err := client.Get(ctx, &devpb.Device{Uuid: args[0]})
+			if err != nil {
+				return err
+			}
+
+			msg := "Device is now: "
+			if skip(r) {
+				msg = "Device is already: "
+			} else if dry {
+				msg = "Device would be: "
+				r.Enabled = !r.Enabled
+			} else {
+				r.Enabled = !r.Enabled
+				r, err = client.Toggle(ctx, r)
+				if err != nil {
+					return err
+				}
+			}
+
+			if outputFormat(cmd) != OUTPUT_TABLE {
+				return printOutput(cmd, r, devicesTable([]*devpb.Device{r}))
+			}
+
+			res := "disabled"
+			if r.Enabled {
+				res = "enabled"
+			}
+			fmt.Println(msg + res)
+
+			return nil
 		}
 
-		r.Enabled = !r.Enabled
-		r, err = client.Toggle(ctx, r)
+		devices, results, err := resolveDevices(cmd, ctx, client, args)
 		if err != nil {
 			return err
 		}
-
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
+		if len(devices) == 0 && len(results) == 0 {
+			return errors.New("no devices matched")
 		}
 
-		res := "disabled"
-		if r.Enabled {
-			res = "enabled"
-		}
-		fmt.Println("Device is now: " + res)
+		results = append(results, runOnDevices(cmd, devices, func(dev *devpb.Device) (string, error) {
+			if skip(dev) {
+				return DEVICE_RESULT_SKIPPED, nil
+			}
+			if dry {
+				return DEVICE_RESULT_DRY_RUN, nil
+			}
+			dev = proto.Clone(dev).(*devpb.Device)
+			dev.Enabled = !dev.Enabled
+			_, err := client.Toggle(ctx, dev)
+			return "", err
+		})...)
 
-		return nil
+		return printDeviceResults(cmd, results)
 	},
 }
 
 var patchConfigDeviceCmd = &cobra.Command{
-	Use:   "config <uuid> <template.[json|yaml]>",
+	Use:   "config <uuid...> <template.[json|yaml]>",
 	Short: "Patch config infinimesh device",
-	Args: cobra.MatchAll(cobra.ExactArgs(2), func(cmd *cobra.Command, args []string) error {
-		if len(args[0]) != 36 {
-			return errors.New("Uuid is not correct.")
+	Long:  "Patch config of infinimesh devices given by UUIDs and/or selected with --selector, template is the last argument",
+	Args: cobra.MatchAll(cobra.MinimumNArgs(1), func(cmd *cobra.Command, args []string) error {
+		if len(args) < 2 && !hasSelector(cmd) {
+			return errors.New("no devices given, pass UUIDs or --selector")
+		}
+		for _, uuid := range args[:len(args)-1] {
+			if len(uuid) != 36 {
+				return errors.New("Uuid is not correct.")
+			}
 		}
 
 		return nil
 	}),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := makeContextWithBearerToken()
-		client, err := makeDevicesServiceClient(ctx)
+		// Template is the same for all the devices, so it's checked before anything is sent
+		template, err := readDeviceTemplate(args[len(args)-1])
 		if err != nil {
 			return err
 		}
 
-		template, err := os.ReadFile(args[1])
+		var device devpb.Device
+		if err := json.Unmarshal(template, &device); err != nil {
+			return fmt.Errorf("error while parsing template: %w", err)
+		}
+
+		ctx := makeContextWithBearerToken()
+		client, err := makeDevicesServiceClient(ctx)
 		if err != nil {
-			fmt.Println("Error while reading template")
 			return err
 		}
 
-		var format string = filepath.Ext(args[1])
+		if uuids := args[:len(args)-1]; len(uuids) > 1 || hasSelector(cmd) {
+			devices, results, err := resolveDevices(cmd, ctx, client, uuids)
+			if err != nil {
+				return err
+			}
+			if len(devices) == 0 && len(results) == 0 {
+				return errors.New("no devices matched")
+			}
 
-		switch format {
-		case ".json":
-		case ".yml", ".yaml":
-			template, err = convert.ConvertBytes(template)
-		default:
-			return errors.New("Unsupported template format " + format)
+			results = append(results, runOnDevices(cmd, devices, func(dev *devpb.Device) (string, error) {
+				patch := proto.Clone(&device).(*devpb.Device)
+				patch.Uuid = dev.Uuid
+				_, err := client.PatchConfig(ctx, patch)
+				return "", err
+			})...)
+			return printDeviceResults(cmd, results)
 		}
 
-		var device devpb.Device
-		err = json.Unmarshal(template, &device)
-
 		device.Uuid = args[0]
 
 		response, err := client.PatchConfig(ctx, &device)
@@ -206,20 +300,29 @@ var patchConfigDeviceCmd = &cobra.Command{
 }
 
 var makeDeviceTokenCmd = &cobra.Command{
-	Use:     "token",
+	Use:     "token [uuid...]",
 	Short:   "Make device token",
+	Long:    "Make token granting access to devices given by UUIDs and/or selected with --selector",
 	Aliases: []string{"tok", "t"},
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !hasSelector(cmd) {
+			return usageError{errors.New("no devices given, pass UUIDs or --selector")}
+		}
+
 		ctx := makeContextWithBearerToken()
 		client, err := makeDevicesServiceClient(ctx)
 		if err != nil {
 			return err
 		}
+		uuids, err := selectDeviceUuids(cmd, ctx, client, args)
+		if err != nil {
+			return err
+		}
 
-		var devices = make(map[string]access.Level, len(args))
+		var devices = make(map[string]access.Level, len(uuids))
 
-		for _, arg := range args {
-			devices[arg] = access.Level_NONE
+		for _, uuid := range uuids {
+			devices[uuid] = access.Level_NONE
 		}
 
 		r, err := client.MakeDevicesToken(ctx, &pb.DevicesTokenRequest{
@@ -233,16 +336,58 @@ var makeDeviceTokenCmd = &cobra.Command{
 			return printJsonResponse(r)
 		}
 
+		if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+			fmt.Fprintf(os.Stderr, "Token grants access to %d device(s)\n", len(uuids))
+		}
 		fmt.Println(r.Token)
 		return nil
 	},
 }
 
+// selectDeviceUuids returns UUIDs given as arguments, along with ones of devices matching --selector
+func selectDeviceUuids(cmd *cobra.Command, ctx context.Context, client pb.DevicesServiceClient, args []string) ([]string, error) {
+	if !hasSelector(cmd) {
+		return args, nil
+	}
+
+	devices, failed, err := resolveDevices(cmd, ctx, client, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("device %s: %s", failed[0].Uuid, failed[0].Error)
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("no devices matched")
+	}
+
+	uuids := make([]string, len(devices))
+	for i, dev := range devices {
+		uuids[i] = dev.Uuid
+	}
+	return uuids, nil
+}
+
 var createDeviceCmd = &cobra.Command{
-	Use:     "create <template.[json|yaml]>",
-	Short:   "Create infinimesh device",
+	Use:   "create <template.[json|yaml]>",
+	Short: "Create infinimesh device",
+	Long: `Create infinimesh device from template, or devices in bulk with -f <devices.[csv|yaml]>
+
+CSV must have header, with columns: title, tags (separated by ;), enabled, namespace, config (json),
+crt (path to certificate) and gen-cert (true to generate certificate into --cert-dir).
+
+With --gen-cert key pair and self-signed certificate are generated (see --key-alg, --subject, --validity)
+and written to --cert-dir with 0600 permissions, for bulk create it applies to rows without crt.
+YAML may have multiple documents, each being device template with optional namespace, crt and gen_cert keys.
+
+Result of each row is written to report (--report), run again with --resume <report> to retry only failed rows.`,
 	Aliases: []string{"add", "a", "new", "crt"},
-	Args:    cobra.ExactArgs(1),
+	Args: cobra.MatchAll(cobra.RangeArgs(0, 1), func(cmd *cobra.Command, args []string) error {
+		if file, _ := cmd.Flags().GetString("file"); (file == "") == (len(args) == 0) {
+			return errors.New("either template or -f devices file must be given")
+		}
+		return nil
+	}),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := makeContextWithBearerToken()
 		client, err := makeDevicesServiceClient(ctx)
@@ -250,6 +395,10 @@ var createDeviceCmd = &cobra.Command{
 			return err
 		}
 
+		if file, _ := cmd.Flags().GetString("file"); file != "" {
+			return bulkCreateDevices(cmd, ctx, client, file)
+		}
+
 		if _, err := os.Stat(args[0]); os.IsNotExist(err) {
 			return errors.New("Template doesn't exist at path " + args[0])
 		}
@@ -279,7 +428,9 @@ var createDeviceCmd = &cobra.Command{
 			return err
 		}
 
-		fmt.Println("Template", string(template))
+		if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+			fmt.Fprintln(os.Stderr, "Template", string(template))
+		}
 
 		var device devpb.Device
 		err = json.Unmarshal(template, &device)
@@ -289,244 +440,1103 @@ var createDeviceCmd = &cobra.Command{
 		}
 
 		soft, _ := cmd.Flags().GetBool("soft")
-		if !soft {
+		var generated []string
+		if genCert, _ := cmd.Flags().GetBool("gen-cert"); genCert {
+			opts, err := certOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			certPEM, keyPEM, err := generateCertificate(opts.forDevice(device.Title))
+			if err != nil {
+				return fmt.Errorf("error while generating certificate: %w", err)
+			}
+
+			dir, _ := cmd.Flags().GetString("cert-dir")
+			crtPath, keyPath, err := writeCertificate(dir, device.Title, certPEM, keyPEM)
+			if err != nil {
+				return fmt.Errorf("error while writing certificate: %w", err)
+			}
+			generated = []string{crtPath, keyPath}
+
+			device.Certificate = &devpb.Certificate{
+				PemData: string(certPEM),
+			}
+		} else if !soft {
 			certPath, _ := cmd.Flags().GetString("crt")
 			if _, err := os.Stat(certPath); os.IsNotExist(err) {
 				return errors.New("Certificate doesn't exist at path " + certPath)
 			}
-			pem, err := os.ReadFile(certPath)
+			pem, err := readDeviceCertificate(certPath)
 			if err != nil {
 				fmt.Println("Error while reading certificate")
 				return err
 			}
 
 			cert := &devpb.Certificate{
-				PemData: string(pem),
+				PemData: pem,
 			}
 			device.Certificate = cert
 		}
 
 		ns, _ := cmd.Flags().GetString("namespace")
+		if ns == "" {
+			ns = viper.GetString("namespace")
+		}
 
 		res, err := client.Create(ctx, &devpb.CreateRequest{
 			Device:    &device,
 			Namespace: ns,
 		})
 		if err != nil {
+			// Key pair is of no use without the device, and would block generating it again
+			for _, path := range generated {
+				os.Remove(path)
+			}
 			return err
 		}
+		if len(generated) > 0 {
+			fmt.Fprintf(os.Stderr, "Certificate written to %s, private key to %s\n", generated[0], generated[1])
+		}
+
+		if outputFormat(cmd) != OUTPUT_TABLE {
+			return printOutput(cmd, res, devicesTable([]*devpb.Device{res.Device}))
+		}
 
 		fmt.Println("Device Created, UUID:", res.Device.Uuid)
 		return nil
 	},
 }
 
-var mgmtDeviceStateCmd = &cobra.Command{
-	Use:   "state",
-	Short: "Manage device state",
+var deleteDeviceCmd = &cobra.Command{
+	Use:     "delete [uuid...]",
+	Short:   "Delete infinimesh devices",
+	Aliases: []string{"del", "rm", "remove"},
+	Long: `Delete infinimesh devices given by UUIDs and/or selected with --selector.
+Devices are deleted along with their states and certificates, preview is shown and confirmation asked before deleting.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !hasSelector(cmd) {
+			return usageError{errors.New("no devices given, pass UUIDs or --selector")}
+		}
+
 		ctx := makeContextWithBearerToken()
+		client, err := makeDevicesServiceClient(ctx)
+		if err != nil {
+			return err
+		}
 
-		var token string
-		if t, _ := cmd.Flags().GetString("token"); t != "" {
-			token = t
-		} else {
-			client, err := makeDevicesServiceClient(ctx)
-			if err != nil {
-				return err
+		devices, results, err := resolveDevices(cmd, ctx, client, args)
+		if err != nil {
+			return err
+		}
+		if len(devices) == 0 {
+			if len(results) > 0 {
+				return printDeviceResults(cmd, results)
 			}
+			return errors.New("no devices matched")
+		}
 
-			var devices = make(map[string]access.Level, len(args))
+		dry, _ := cmd.Flags().GetBool("dry-run")
+		if !dry {
+			if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+				fmt.Fprintf(os.Stderr, "Following %d device(s) will be deleted along with their states:\n", len(devices))
+				devicesTable(devices).RenderTo(os.Stderr, false)
+
+				if !isInteractive() {
+					return usageError{errors.New("can't ask for confirmation, use --yes to delete without it")}
+				}
+				prompt := promptui.Prompt{
+					Label:     "Delete",
+					IsConfirm: true,
+				}
+				if _, err := prompt.Run(); err != nil {
+					return errors.New("aborted")
+				}
+			}
+		}
 
-			for _, arg := range args {
-				devices[arg] = access.Level_NONE
+		results = append(results, runOnDevices(cmd, devices, func(dev *devpb.Device) (string, error) {
+			if dry {
+				return DEVICE_RESULT_DRY_RUN, nil
 			}
+			_, err := client.Delete(ctx, &devpb.Device{Uuid: dev.Uuid})
+			return "", err
+		})...)
 
-			r, err := client.MakeDevicesToken(ctx, &pb.DevicesTokenRequest{
-				Devices: devices,
-			})
+		return printDeviceResults(cmd, results)
+	},
+}
+
+var updateDeviceCmd = &cobra.Command{
+	Use:   "update <uuid...>",
+	Short: "Update infinimesh device",
+	Long: `Update infinimesh device title and tags, or any fields with -f template.[json|yaml].
+Fields present in the template replace the device ones, absent fields are kept. Flags are applied on top of the template. Changes are shown and confirmation asked before updating.
+Tags of multiple devices (given by UUIDs and/or selected with --selector) can be changed at once.`,
+	Aliases: []string{"upd", "edit"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		single := len(args) == 1 && !hasSelector(cmd)
+		path, _ := cmd.Flags().GetString("file")
+		if !single {
+			if len(args) == 0 && !hasSelector(cmd) {
+				return usageError{errors.New("no devices given, pass UUID(s) or --selector")}
+			}
+			if title, _ := cmd.Flags().GetString("title"); path != "" || title != "" {
+				return usageError{errors.New("-f and --title can only be used to update single device")}
+			}
+		}
 
+		var template []byte
+		if path != "" {
+			t, err := readDeviceTemplate(path)
 			if err != nil {
 				return err
 			}
-			token = r.Token
+			template = t
 		}
 
-		ctx = metadata.AppendToOutgoingContext(context.Background(), "Authorization", "Bearer "+token)
-		client, err := makeShadowServiceClient(ctx)
+		ctx := makeContextWithBearerToken()
+		client, err := makeDevicesServiceClient(ctx)
 		if err != nil {
 			return err
 		}
 
-		if patch, _ := cmd.Flags().GetString("patch"); patch != "" {
-			req := &shadowpb.Shadow{
-				Device: args[0],
-				Desired: &shadowpb.State{
-					Data: &structpb.Struct{},
-				},
-			}
-
-			err = req.Desired.Data.UnmarshalJSON([]byte(patch))
-			if err != nil {
-				return err
-			}
-
-			_, err = client.Patch(ctx, req)
+		var olds []*devpb.Device
+		var results []deviceResult
+		if single {
+			old, err := client.Get(ctx, &devpb.Device{Uuid: args[0]})
 			if err != nil {
 				return err
 			}
+			olds = append(olds, old)
+		} else if olds, results, err = resolveDevices(cmd, ctx, client, args); err != nil {
+			return err
 		}
 
-		if report, _ := cmd.Flags().GetString("report"); report != "" {
-			req := &shadowpb.Shadow{
-				Device: args[0],
-				Reported: &shadowpb.State{
-					Data: &structpb.Struct{},
-				},
-			}
-
-			err = req.Reported.Data.UnmarshalJSON([]byte(report))
-			if err != nil {
-				fmt.Printf("Attempted Report: '%s'\n", report)
-				return err
+		updated := make(map[string]*devpb.Device)
+		var changed []*devpb.Device
+		color := isTerminal(os.Stderr)
+		for _, old := range olds {
+			device := proto.Clone(old).(*devpb.Device)
+			if template != nil {
+				if err := applyDeviceTemplate(device, template); err != nil {
+					return err
+				}
 			}
+			applyDeviceUpdateFlags(cmd, device)
 
-			_, err = client.Patch(ctx, req)
+			diff, err := diffJson(old, device)
 			if err != nil {
 				return err
 			}
-		}
-
-		if remove, _ := cmd.Flags().GetString("remove"); remove != "" {
-			input := strings.SplitN(remove, ".", 2)
-			req := &shadowpb.RemoveRequest{
-				Device: args[0],
+			if len(diff) == 0 {
+				results = append(results, deviceResult{Uuid: old.Uuid, Title: old.Title, Result: DEVICE_RESULT_SKIPPED})
+				continue
 			}
-			if input[0] == "reported" {
-				req.StateKey = shadowpb.StateKey_REPORTED
-			} else {
-				req.StateKey = shadowpb.StateKey_DESIRED
+			updated[old.Uuid] = device
+			changed = append(changed, old)
+
+			fmt.Fprintf(os.Stderr, "Device %s changes:\n", old.Uuid)
+			for _, line := range diff {
+				if color && strings.HasPrefix(line, "-") {
+					line = text.FgRed.Sprint(line)
+				} else if color {
+					line = text.FgGreen.Sprint(line)
+				}
+				fmt.Fprintln(os.Stderr, line)
 			}
+		}
 
-			req.Key = input[1]
-
-			state, err := client.Remove(ctx, req)
-			if err != nil {
-				return err
+		if len(changed) == 0 {
+			if single || len(results) == 0 {
+				fmt.Fprintln(os.Stderr, "Nothing to update")
+				return nil
 			}
+			return printDeviceResults(cmd, results)
+		}
 
-			PrintSingleDeviceState(state)
+		dry, _ := cmd.Flags().GetBool("dry-run")
+		if dry && single {
 			return nil
 		}
-
-		if stream, _ := cmd.Flags().GetBool("stream"); stream {
-			delta, _ := cmd.Flags().GetBool("delta")
-			sync, _ := cmd.Flags().GetBool("sync")
-			c, err := client.StreamShadow(ctx, &shadowpb.StreamShadowRequest{OnlyDelta: delta, Sync: sync})
-			if err != nil {
-				return err
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes && !dry {
+			if !isInteractive() {
+				return usageError{errors.New("can't ask for confirmation, use --yes to update without it")}
 			}
-
-			printJson, _ := cmd.Flags().GetBool("json")
-			if !printJson {
-				fmt.Println("Streaming started")
+			prompt := promptui.Prompt{
+				Label:     "Update",
+				IsConfirm: true,
 			}
-			for {
-				msg, err := c.Recv()
-				if err != nil {
-					return err
-				}
-				if printJson {
-					printJsonResponse(msg)
-				} else {
-					PrintSingleDeviceState(msg)
-				}
+			if _, err := prompt.Run(); err != nil {
+				return errors.New("aborted")
 			}
 		}
 
-		r, err := client.Get(ctx, &shadowpb.GetRequest{
-			Pool: args,
-		})
+		if !single {
+			results = append(results, runOnDevices(cmd, changed, func(dev *devpb.Device) (string, error) {
+				if dry {
+					return DEVICE_RESULT_DRY_RUN, nil
+				}
+				_, err := client.Update(ctx, deviceUpdate(updated[dev.Uuid]))
+				return "", err
+			})...)
+			return printDeviceResults(cmd, results)
+		}
+
+		r, err := client.Update(ctx, deviceUpdate(updated[olds[0].Uuid]))
 		if err != nil {
 			return err
 		}
 
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
+		if outputFormat(cmd) == OUTPUT_TABLE {
+			PrintSingleDevice(r)
+			return nil
 		}
+		return printOutput(cmd, r, devicesTable([]*devpb.Device{r}))
+	},
+}
 
-		for _, shadow := range r.GetShadows() {
-			PrintSingleDeviceState(shadow)
+// applyDeviceUpdateFlags sets title and changes tags of the device as requested by update flags
+func applyDeviceUpdateFlags(cmd *cobra.Command, device *devpb.Device) {
+	if title, _ := cmd.Flags().GetString("title"); title != "" {
+		device.Title = title
+	}
+	if cmd.Flags().Changed("set-tags") {
+		device.Tags, _ = cmd.Flags().GetStringSlice("set-tags")
+	}
+	add, _ := cmd.Flags().GetStringSlice("add-tag")
+	for _, tag := range add {
+		if !containsString(device.Tags, tag) {
+			device.Tags = append(device.Tags, tag)
 		}
-		return nil
-	},
+	}
+	remove, _ := cmd.Flags().GetStringSlice("remove-tag")
+	tags := make([]string, 0, len(device.Tags))
+	for _, tag := range device.Tags {
+		if !containsString(remove, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	device.Tags = tags
 }
 
-var mgmtDevIceStateMQTTCmd = &cobra.Command{
-	Use:   "mqtt",
-	Short: "Manage device state via MQTT",
-	RunE: func(cmd *cobra.Command, args []string) error {
+var rotateCertDeviceCmd = &cobra.Command{
+	Use:   "rotate-cert <uuid>",
+	Short: "Replace infinimesh device certificate",
+	Long: `Replace infinimesh device certificate with the one given by --crt or generated with --gen-cert.
 
-		opts := MQTT.NewClientOptions()
+With --verify-mqtt new certificate is checked to connect to MQTT broker (same as inf devices state mqtt),
+old certificate is restored if it can't.`,
+	Aliases: []string{"rotate"},
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		crtPath, _ := cmd.Flags().GetString("crt")
+		keyPath, _ := cmd.Flags().GetString("key")
+		genCert, _ := cmd.Flags().GetBool("gen-cert")
+		verify, _ := cmd.Flags().GetBool("verify-mqtt")
+		if crtPath == "" && !genCert {
+			return usageError{errors.New("either --crt or --gen-cert must be given")}
+		}
+		if verify && crtPath != "" && keyPath == "" {
+			return usageError{errors.New("--key is required to verify MQTT connection with --crt")}
+		}
 
-		broker, _ := cmd.Flags().GetString("host")
-		if broker == "" {
-			broker = strings.Replace(
-				strings.Split(viper.GetString("infinimesh"), ":")[0],
-				"api.", "mqtt.", 1)
+		ctx := makeContextWithBearerToken()
+		client, err := makeDevicesServiceClient(ctx)
+		if err != nil {
+			return err
 		}
 
-		port, _ := cmd.Flags().GetString("port")
-		if basic, _ := cmd.Flags().GetString("basic"); basic != "" {
-			cred := strings.Split(basic, ":")
-			opts.SetUsername(cred[0])
-			opts.SetPassword(cred[1])
+		old, err := client.Get(ctx, &devpb.Device{Uuid: args[0]})
+		if err != nil {
+			return err
+		}
 
-			if port == "" {
-				port = "1883"
-			}
-			broker = "mqtt://" + broker + ":" + port
-		} else {
-			cert_path, _ := cmd.Flags().GetString("crt")
-			if cert_path == "" {
-				return errors.New("no certificate given")
+		var certPEM string
+		var generated []string
+		if genCert {
+			opts, err := certOptionsFromFlags(cmd)
+			if err != nil {
+				return err
 			}
-			key_path, _ := cmd.Flags().GetString("key")
-			if key_path == "" {
-				return errors.New("no key given")
+			crt, key, err := generateCertificate(opts.forDevice(old.Title))
+			if err != nil {
+				return fmt.Errorf("error while generating certificate: %w", err)
 			}
+			certPEM = string(crt)
 
-			cert, err := tls.LoadX509KeyPair(cert_path, key_path)
+			fingerprint, err := pemFingerprint(certPEM)
 			if err != nil {
 				return err
 			}
-
-			opts.SetTLSConfig(&tls.Config{
-				Certificates:       []tls.Certificate{cert},
-				ClientAuth:         tls.NoClientCert,
-				ClientCAs:          nil,
-				InsecureSkipVerify: true,
-			})
-
-			if port == "" {
-				port = "8883"
+			// Previous certificate of the device is likely in the same dir
+			dir, _ := cmd.Flags().GetString("cert-dir")
+			crtPath, keyPath, err = writeCertificate(dir, old.Title+"-"+hex.EncodeToString(fingerprint[:4]), crt, key)
+			if err != nil {
+				return fmt.Errorf("error while writing certificate: %w", err)
 			}
-			broker = "mqtts://" + broker + ":" + port
+			generated = []string{crtPath, keyPath}
+		} else if certPEM, err = readDeviceCertificate(crtPath); err != nil {
+			return err
 		}
 
-		opts.AddBroker(broker)
-
-		client_id, _ := cmd.Flags().GetString("client-id")
-		opts.SetClientID(client_id)
-
-		client := MQTT.NewClient(opts)
-		if token := client.Connect(); token.Wait() && token.Error() != nil {
-			return token.Error()
+		fingerprint, err := pemFingerprint(certPEM)
+		if err != nil {
+			return err
+		}
+		if old.Certificate != nil && bytes.Equal(old.Certificate.Fingerprint, fingerprint) {
+			return errors.New("device already has this certificate")
 		}
 
-		desired, _ := cmd.Flags().GetBool("desired")
-		if desired {
-			messages := make(chan string, 2)
+		device := deviceUpdate(old)
+		device.Certificate = &devpb.Certificate{PemData: certPEM}
+		r, err := client.Update(ctx, device)
+		if err != nil {
+			removeFiles(generated)
+			return err
+		}
+		// Device is read back if the certificate isn't returned, replacement counts only when confirmed
+		current := r.GetCertificate().GetFingerprint()
+		if len(current) == 0 {
+			if dev, err := client.Get(ctx, &devpb.Device{Uuid: old.Uuid}); err == nil {
+				current = dev.GetCertificate().GetFingerprint()
+			}
+		}
+		if len(current) == 0 {
+			removeFiles(generated)
+			return errors.New("can't confirm certificate was replaced, server returned no certificate fingerprint")
+		}
+		if !bytes.Equal(current, fingerprint) {
+			removeFiles(generated)
+			return errors.New("certificate wasn't replaced, device still has the old one")
+		}
+		if len(generated) > 0 {
+			fmt.Fprintf(os.Stderr, "Certificate written to %s, private key to %s\n", generated[0], generated[1])
+		}
+
+		if verify {
+			if err := verifyMQTTConnection(cmd, crtPath, keyPath); err != nil {
+				// Generated files are kept if the device is left with the new certificate
+				if _, rerr := client.Update(ctx, deviceUpdate(old)); rerr != nil {
+					return fmt.Errorf("new certificate can't connect to MQTT broker: %w, restoring old certificate failed too: %w", err, rerr)
+				}
+				removeFiles(generated)
+				return fmt.Errorf("new certificate can't connect to MQTT broker, old certificate is restored: %w", err)
+			}
+			fmt.Fprintln(os.Stderr, "New certificate connected to MQTT broker")
+		}
+
+		if outputFormat(cmd) == OUTPUT_TABLE {
+			fmt.Printf("UUID: %s\n", r.Uuid)
+			fmt.Printf("Title: %s\n", r.Title)
+			printFingerprint("Old Fingerprint", old.Certificate)
+			if r.Certificate == nil || len(r.Certificate.Fingerprint) == 0 {
+				r.Certificate = &devpb.Certificate{Algorithm: "sha256", Fingerprint: fingerprint}
+			}
+			printFingerprint("New Fingerprint", r.Certificate)
+			return nil
+		}
+		return printOutput(cmd, r, devicesTable([]*devpb.Device{r}))
+	},
+}
+
+var whoisDeviceCmd = &cobra.Command{
+	Use:   "whois",
+	Short: "Find infinimesh device by certificate or its fingerprint",
+	Long: `Find infinimesh device by certificate (--crt, PEM or DER) or its SHA-256 fingerprint (--fingerprint, hex)
+and print the device along with its namespace`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var fingerprint []byte
+		if path, _ := cmd.Flags().GetString("crt"); path != "" {
+			cert, err := readCertificateFile(path)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(cert.Raw)
+			fingerprint = sum[:]
+		} else if hash, _ := cmd.Flags().GetString("fingerprint"); hash != "" {
+			var err error
+			fingerprint, err = hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(hash), ":", ""))
+			if err != nil || len(fingerprint) != sha256.Size {
+				return usageError{fmt.Errorf("fingerprint must be SHA-256 hash in hex, got %q", hash)}
+			}
+		} else {
+			return usageError{errors.New("either --crt or --fingerprint must be given")}
+		}
+
+		ctx := makeContextWithBearerToken()
+		client, err := makeDevicesServiceClient(ctx)
+		if err != nil {
+			return err
+		}
+
+		dev, err := client.GetByFingerprint(ctx, &devpb.GetByFingerprintRequest{Fingerprint: fingerprint})
+		if err != nil {
+			return err
+		}
+
+		var ns *nspb.Namespace
+		if dev.Access != nil && dev.Access.Namespace != nil {
+			ns = &nspb.Namespace{Uuid: *dev.Access.Namespace}
+			if nsClient, err := makeNamespacesServiceClient(ctx); err == nil {
+				// Title is nice to have, device might be shared from namespace account can't see
+				if r, err := nsClient.Get(ctx, ns); err == nil {
+					ns = r
+				}
+			}
+		}
+
+		switch outputFormat(cmd) {
+		case OUTPUT_TABLE, OUTPUT_WIDE:
+			PrintSingleDevice(dev)
+			switch {
+			case ns == nil:
+				fmt.Println("Namespace: -")
+			case ns.Title != "":
+				fmt.Printf("Namespace: %s (%s)\n", ns.Title, ns.Uuid)
+			default:
+				fmt.Printf("Namespace: %s\n", ns.Uuid)
+			}
+			return nil
+		}
+		return printOutput(cmd, map[string]interface{}{
+			"device":    dev,
+			"namespace": ns,
+		}, devicesTable([]*devpb.Device{dev}))
+	},
+}
+
+// deviceCertificate is the device certificate details parsed from its PEM
+type deviceCertificate struct {
+	Uuid        string     `json:"uuid"`
+	Title       string     `json:"title"`
+	Algorithm   string     `json:"algorithm,omitempty"`
+	Fingerprint string     `json:"fingerprint,omitempty"`
+	Subject     string     `json:"subject,omitempty"`
+	Issuer      string     `json:"issuer,omitempty"`
+	NotBefore   *time.Time `json:"not_before,omitempty"`
+	NotAfter    *time.Time `json:"not_after,omitempty"`
+	DaysLeft    *int       `json:"days_left,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// makeDeviceCertificate parses device certificate, devices without one (soft) have only uuid and title set
+func makeDeviceCertificate(dev *devpb.Device) deviceCertificate {
+	res := deviceCertificate{Uuid: dev.Uuid, Title: dev.Title}
+	if dev.Certificate == nil || dev.Certificate.PemData == "" {
+		return res
+	}
+
+	block, _ := pem.Decode([]byte(dev.Certificate.PemData))
+	if block == nil {
+		res.Error = "no certificate found in PEM"
+		return res
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	res.Algorithm = publicKeyAlgorithm(cert)
+	res.Fingerprint = certificateFingerprint(cert)
+	res.Subject = cert.Subject.String()
+	res.Issuer = cert.Issuer.String()
+	res.NotBefore, res.NotAfter = &cert.NotBefore, &cert.NotAfter
+	days := int(math.Floor(time.Until(cert.NotAfter).Hours() / 24))
+	res.DaysLeft = &days
+	return res
+}
+
+// publicKeyAlgorithm describes certificate key, like ECDSA P-256 or RSA 2048
+func publicKeyAlgorithm(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+func deviceCertificatesTable(pool []deviceCertificate) *Table {
+	optional := func(v interface{}, ok bool) interface{} {
+		if !ok {
+			return "-"
+		}
+		return v
+	}
+	date := func(t *time.Time) interface{} {
+		if t == nil {
+			return "-"
+		}
+		return t.Local().Format(time.RFC1123)
+	}
+
+	return NewTable("device", pool, func(c deviceCertificate) string { return c.Uuid },
+		Column[deviceCertificate]{Name: "UUID", Value: func(c deviceCertificate) interface{} { return c.Uuid }},
+		Column[deviceCertificate]{Name: "Title", Value: func(c deviceCertificate) interface{} { return c.Title }},
+		Column[deviceCertificate]{Name: "Algorithm", Value: func(c deviceCertificate) interface{} { return optional(c.Algorithm, c.Algorithm != "") }},
+		Column[deviceCertificate]{Name: "Fingerprint", Value: func(c deviceCertificate) interface{} { return optional(c.Fingerprint, c.Fingerprint != "") }},
+		Column[deviceCertificate]{Name: "Subject", Value: func(c deviceCertificate) interface{} { return optional(c.Subject, c.Subject != "") }},
+		Column[deviceCertificate]{Name: "Issuer", Wide: true, Value: func(c deviceCertificate) interface{} { return optional(c.Issuer, c.Issuer != "") }},
+		Column[deviceCertificate]{Name: "Not Before", Value: func(c deviceCertificate) interface{} { return date(c.NotBefore) }},
+		Column[deviceCertificate]{Name: "Not After", Value: func(c deviceCertificate) interface{} { return date(c.NotAfter) }},
+		Column[deviceCertificate]{Name: "Days Left", Value: func(c deviceCertificate) interface{} {
+			if c.DaysLeft == nil {
+				return "-"
+			}
+			return *c.DaysLeft
+		}},
+		Column[deviceCertificate]{Name: "Error", Wide: true, Value: func(c deviceCertificate) interface{} { return c.Error }},
+		// Devices without certificate go last
+		Column[deviceCertificate]{Name: "Expiry", Hidden: true, Value: func(c deviceCertificate) interface{} {
+			if c.NotAfter == nil {
+				return int64(math.MaxInt64)
+			}
+			return c.NotAfter.Unix()
+		}},
+	).Sort(table.SortBy{Name: "Expiry", Mode: table.AscNumeric})
+}
+
+var certsDevicesCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "List infinimesh devices certificates",
+	Long: `List infinimesh devices certificates: key algorithm, fingerprint, subject, validity and days left until expiry.
+
+With --expiring-within only certificates expiring within given time (or expired already, or unreadable) are listed,
+and command exits with code 11 if there are any, e.g. inf devices certs --expiring-within 30d can be run as an expiry alarm.`,
+	Aliases: []string{"certificates"},
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var within time.Duration
+		if s, _ := cmd.Flags().GetString("expiring-within"); s != "" {
+			var err error
+			if within, err = parseDuration(s); err != nil {
+				return usageError{fmt.Errorf("invalid --expiring-within: %w", err)}
+			}
+		}
+
+		ctx := makeContextWithBearerToken()
+		client, err := makeDevicesServiceClient(ctx)
+		if err != nil {
+			return err
+		}
+
+		req := &pb.QueryRequest{}
+		ns, _ := cmd.Flags().GetString("ns")
+		if ns == "" {
+			ns = viper.GetString("namespace")
+		}
+		if ns != "" {
+			req.Namespace = &ns
+		}
+
+		r, err := client.List(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		pool := make([]deviceCertificate, 0, len(r.Devices))
+		deadline := time.Now().Add(within)
+		for _, dev := range r.Devices {
+			c := makeDeviceCertificate(dev)
+			// Certificates which can't be parsed are listed too, as they can't be checked
+			if cmd.Flags().Changed("expiring-within") && c.Error == "" && (c.NotAfter == nil || c.NotAfter.After(deadline)) {
+				continue
+			}
+			pool = append(pool, c)
+		}
+
+		if err := printOutput(cmd, pool, deviceCertificatesTable(pool)); err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("expiring-within") && len(pool) > 0 {
+			return exitCodeError{EXIT_CERTS_EXPIRING, fmt.Errorf("%d device certificate(s) expire within %s or can't be read", len(pool), within)}
+		}
+		return nil
+	},
+}
+
+// verifyMQTTConnection connects to MQTT broker with the certificate and disconnects right away
+func verifyMQTTConnection(cmd *cobra.Command, crtPath, keyPath string) error {
+	opts, err := mqttClientOptions(cmd, crtPath, keyPath)
+	if err != nil {
+		return err
+	}
+	timeout, _ := cmd.Flags().GetDuration("mqtt-timeout")
+	opts.SetConnectTimeout(timeout)
+	opts.SetAutoReconnect(false)
+
+	client := MQTT.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("no connection after %s", timeout)
+	}
+	if err := token.Error(); err != nil {
+		return err
+	}
+	client.Disconnect(250)
+	return nil
+}
+
+// readDeviceTemplate reads json or yaml Device template, converting it to json
+func readDeviceTemplate(path string) ([]byte, error) {
+	template, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format := filepath.Ext(path); format {
+	case ".json":
+	case ".yml", ".yaml":
+		template, err = convert.ConvertBytes(template)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing template: %w", err)
+		}
+	default:
+		return nil, errors.New("Unsupported template format " + format)
+	}
+
+	return template, nil
+}
+
+// Device fields set by the server, they're neither taken from templates nor sent on update
+var DEVICE_READ_ONLY_FIELDS = []string{"uuid", "access"}
+
+// applyDeviceTemplate sets the device fields present in the template, fields absent from it are kept as is
+func applyDeviceTemplate(device *devpb.Device, template []byte) error {
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(template, &present); err != nil {
+		return fmt.Errorf("error while parsing template: %w", err)
+	}
+	tmpl := &devpb.Device{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(template, tmpl); err != nil {
+		return fmt.Errorf("error while parsing template: %w", err)
+	}
+
+	dst, src := device.ProtoReflect(), tmpl.ProtoReflect()
+	fields := dst.Descriptor().Fields()
+	for key := range present {
+		fd := fields.ByJSONName(key)
+		if fd == nil {
+			fd = fields.ByName(protoreflect.Name(key))
+		}
+		// Unknown fields are discarded
+		if fd == nil || containsString(DEVICE_READ_ONLY_FIELDS, string(fd.Name())) {
+			continue
+		}
+		// Field set to zero value (or null) explicitly is cleared
+		if src.Has(fd) {
+			dst.Set(fd, src.Get(fd))
+		} else {
+			dst.Clear(fd)
+		}
+	}
+	return nil
+}
+
+// deviceUpdate makes Update request out of the device, leaving out fields set by the server
+func deviceUpdate(device *devpb.Device) *devpb.Device {
+	req := proto.Clone(device).(*devpb.Device)
+	req.Access = nil
+	if req.Certificate != nil {
+		req.Certificate.Fingerprint = nil
+		req.Certificate.Algorithm = ""
+	}
+	return req
+}
+
+func containsString(pool []string, s string) bool {
+	for _, el := range pool {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
+
+// diffJson compares json representations of old and new, returning changed fields as -/+ lines
+func diffJson(old, new interface{}) ([]string, error) {
+	a, err := toGeneric(old)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toGeneric(new)
+	if err != nil {
+		return nil, err
+	}
+
+	before, after := make(map[string]string), make(map[string]string)
+	flattenJson("", a, before)
+	flattenJson("", b, after)
+
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, key := range keys {
+		was, hadKey := before[key]
+		is, hasKey := after[key]
+		if hadKey && hasKey && was == is {
+			continue
+		}
+		if hadKey {
+			lines = append(lines, fmt.Sprintf("- %s: %s", key, was))
+		}
+		if hasKey {
+			lines = append(lines, fmt.Sprintf("+ %s: %s", key, is))
+		}
+	}
+	return lines, nil
+}
+
+// flattenJson flattens objects into dot separated keys, other values are kept as json
+func flattenJson(prefix string, v interface{}, out map[string]string) {
+	if obj, ok := v.(map[string]interface{}); ok && (len(obj) > 0 || prefix == "") {
+		for key, val := range obj {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flattenJson(key, val, out)
+		}
+		return
+	}
+
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		bytes = []byte(fmt.Sprint(v))
+	}
+	out[prefix] = string(bytes)
+}
+
+var mgmtDeviceStateCmd = &cobra.Command{
+	Use:   "state [uuid...]",
+	Short: "Manage device state",
+	Long: `Get, stream or change state of devices given by UUIDs and/or selected with --selector.
+When changing state of multiple devices (--patch, --report, --remove), result of each is printed as a table.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := makeContextWithBearerToken()
+
+		if len(args) == 0 && !hasSelector(cmd) {
+			return usageError{errors.New("no devices given, pass UUIDs or --selector")}
+		}
+
+		patch, _ := cmd.Flags().GetString("patch")
+		report, _ := cmd.Flags().GetString("report")
+		remove, _ := cmd.Flags().GetString("remove")
+		if (patch != "" || report != "" || remove != "") && (len(args) > 1 || hasSelector(cmd)) {
+			return changeDevicesStates(cmd, ctx, args)
+		}
+
+		if hasSelector(cmd) {
+			devClient, err := makeDevicesServiceClient(ctx)
+			if err != nil {
+				return err
+			}
+			if args, err = selectDeviceUuids(cmd, ctx, devClient, args); err != nil {
+				return err
+			}
+		}
+
+		token, _ := cmd.Flags().GetString("token")
+		// Token is renewed while streaming unless it's given explicitly
+		renew := token == ""
+		if renew {
+			var err error
+			token, err = makeDevicesToken(ctx, args)
+			if err != nil {
+				return err
+			}
+		}
+
+		ctx = metadata.AppendToOutgoingContext(context.Background(), "Authorization", "Bearer "+token)
+		client, err := makeShadowServiceClient(ctx)
+		if err != nil {
+			return err
+		}
+
+		if patch != "" {
+			req := &shadowpb.Shadow{
+				Device: args[0],
+				Desired: &shadowpb.State{
+					Data: &structpb.Struct{},
+				},
+			}
+
+			err = req.Desired.Data.UnmarshalJSON([]byte(patch))
+			if err != nil {
+				return err
+			}
+
+			_, err = client.Patch(ctx, req)
+			if err != nil {
+				return err
+			}
+		}
+
+		if report != "" {
+			req := &shadowpb.Shadow{
+				Device: args[0],
+				Reported: &shadowpb.State{
+					Data: &structpb.Struct{},
+				},
+			}
+
+			err = req.Reported.Data.UnmarshalJSON([]byte(report))
+			if err != nil {
+				fmt.Printf("Attempted Report: '%s'\n", report)
+				return err
+			}
+
+			_, err = client.Patch(ctx, req)
+			if err != nil {
+				return err
+			}
+		}
+
+		if remove != "" {
+			input := strings.SplitN(remove, ".", 2)
+			req := &shadowpb.RemoveRequest{
+				Device: args[0],
+			}
+			if input[0] == "reported" {
+				req.StateKey = shadowpb.StateKey_REPORTED
+			} else {
+				req.StateKey = shadowpb.StateKey_DESIRED
+			}
+
+			req.Key = input[1]
+
+			state, err := client.Remove(ctx, req)
+			if err != nil {
+				return err
+			}
+
+			if outputFormat(cmd) == OUTPUT_TABLE {
+				PrintSingleDeviceState(state)
+				return nil
+			}
+			return printOutput(cmd, state, shadowsTable([]*shadowpb.Shadow{state}))
+		}
+
+		if stream, _ := cmd.Flags().GetBool("stream"); stream {
+			delta, _ := cmd.Flags().GetBool("delta")
+			sync, _ := cmd.Flags().GetBool("sync")
+			req := &shadowpb.StreamShadowRequest{OnlyDelta: delta, Sync: sync}
+
+			printJson := outputFormat(cmd) == OUTPUT_JSON
+			if !printJson {
+				fmt.Println("Streaming started")
+			}
+			// Consecutive reconnects without any message in between
+			failures := 0
+			for {
+				streamCtx, cancel := context.WithCancel(ctx)
+				if exp, err := tokenExpires(token); renew && err == nil && time.Until(exp) > 2*TOKEN_RENEW_BEFORE {
+					streamCtx, cancel = context.WithDeadline(ctx, exp.Add(-TOKEN_RENEW_BEFORE))
+				}
+
+				received, err := streamDeviceState(streamCtx, client, req, printJson)
+				// Deadline set above is a planned renewal, not a failure
+				planned := streamCtx.Err() == context.DeadlineExceeded
+				cancel()
+
+				code := status.Code(err)
+				if !renew || (code != codes.Unauthenticated && code != codes.DeadlineExceeded) {
+					return err
+				}
+
+				if received || planned {
+					failures = 0
+				} else {
+					failures++
+				}
+				if failures >= STREAM_RENEW_ATTEMPTS {
+					return fmt.Errorf("giving up after %d failed reconnects: %w", failures, err)
+				}
+				if failures > 0 {
+					time.Sleep(streamRenewBackoff(failures))
+				}
+
+				token, err = makeDevicesToken(makeContextWithBearerToken(), args)
+				if err != nil {
+					return err
+				}
+				ctx = metadata.AppendToOutgoingContext(context.Background(), "Authorization", "Bearer "+token)
+
+				if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+					fmt.Fprintln(os.Stderr, "Device token renewed, reconnecting")
+				}
+			}
+		}
+
+		r, err := client.Get(ctx, &shadowpb.GetRequest{
+			Pool: args,
+		})
+		if err != nil {
+			return err
+		}
+
+		if outputFormat(cmd) == OUTPUT_TABLE {
+			for _, shadow := range r.GetShadows() {
+				PrintSingleDeviceState(shadow)
+			}
+			return nil
+		}
+		return printOutput(cmd, r, shadowsTable(r.GetShadows()))
+	},
+}
+
+// changeDevicesStates patches desired and reported states and removes state keys of the devices concurrently
+func changeDevicesStates(cmd *cobra.Command, ctx context.Context, args []string) error {
+	var desired, reported *structpb.Struct
+	if patch, _ := cmd.Flags().GetString("patch"); patch != "" {
+		desired = &structpb.Struct{}
+		if err := desired.UnmarshalJSON([]byte(patch)); err != nil {
+			return usageError{fmt.Errorf("invalid --patch: %w", err)}
+		}
+	}
+	if report, _ := cmd.Flags().GetString("report"); report != "" {
+		reported = &structpb.Struct{}
+		if err := reported.UnmarshalJSON([]byte(report)); err != nil {
+			return usageError{fmt.Errorf("invalid --report: %w", err)}
+		}
+	}
+	var removeReq *shadowpb.RemoveRequest
+	if remove, _ := cmd.Flags().GetString("remove"); remove != "" {
+		key, name, ok := strings.Cut(remove, ".")
+		if !ok || (key != "reported" && key != "desired") {
+			return usageError{fmt.Errorf("--remove must be <reported|desired>.<key>, got %q", remove)}
+		}
+		removeReq = &shadowpb.RemoveRequest{Key: name, StateKey: shadowpb.StateKey_DESIRED}
+		if key == "reported" {
+			removeReq.StateKey = shadowpb.StateKey_REPORTED
+		}
+	}
+
+	devClient, err := makeDevicesServiceClient(ctx)
+	if err != nil {
+		return err
+	}
+	devices, results, err := resolveDevices(cmd, ctx, devClient, args)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		if len(results) > 0 {
+			return printDeviceResults(cmd, results)
+		}
+		return errors.New("no devices matched")
+	}
+
+	token, _ := cmd.Flags().GetString("token")
+	if token == "" {
+		uuids := make([]string, len(devices))
+		for i, dev := range devices {
+			uuids[i] = dev.Uuid
+		}
+		if token, err = makeDevicesToken(ctx, uuids); err != nil {
+			return err
+		}
+	}
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "Authorization", "Bearer "+token)
+	client, err := makeShadowServiceClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	results = append(results, runOnDevices(cmd, devices, func(dev *devpb.Device) (string, error) {
+		if desired != nil {
+			if _, err := client.Patch(ctx, &shadowpb.Shadow{Device: dev.Uuid, Desired: &shadowpb.State{Data: desired}}); err != nil {
+				return "", err
+			}
+		}
+		if reported != nil {
+			if _, err := client.Patch(ctx, &shadowpb.Shadow{Device: dev.Uuid, Reported: &shadowpb.State{Data: reported}}); err != nil {
+				return "", err
+			}
+		}
+		if removeReq != nil {
+			if _, err := client.Remove(ctx, &shadowpb.RemoveRequest{Device: dev.Uuid, Key: removeReq.Key, StateKey: removeReq.StateKey}); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	})...)
+
+	return printDeviceResults(cmd, results)
+}
+
+// makeDevicesToken obtains token granting access to the given devices
+func makeDevicesToken(ctx context.Context, uuids []string) (string, error) {
+	client, err := makeDevicesServiceClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var devices = make(map[string]access.Level, len(uuids))
+
+	for _, uuid := range uuids {
+		devices[uuid] = access.Level_NONE
+	}
+
+	r, err := client.MakeDevicesToken(ctx, &pb.DevicesTokenRequest{
+		Devices: devices,
+	})
+	if err != nil {
+		return "", err
+	}
+	return r.Token, nil
+}
+
+// streamDeviceState prints device states until the stream is closed, telling whether any was received
+func streamDeviceState(ctx context.Context, client pb.ShadowServiceClient, req *shadowpb.StreamShadowRequest, printJson bool) (bool, error) {
+	c, err := client.StreamShadow(ctx, req)
+	if err != nil {
+		return false, err
+	}
+
+	for received := false; ; received = true {
+		msg, err := c.Recv()
+		if err != nil {
+			return received, err
+		}
+		if printJson {
+			printJsonResponse(msg)
+		} else {
+			PrintSingleDeviceState(msg)
+		}
+	}
+}
+
+var mgmtDevIceStateMQTTCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "Manage device state via MQTT",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cert_path, _ := cmd.Flags().GetString("crt")
+		key_path, _ := cmd.Flags().GetString("key")
+		opts, err := mqttClientOptions(cmd, cert_path, key_path)
+		if err != nil {
+			return err
+		}
+
+		client := MQTT.NewClient(opts)
+		if token := client.Connect(); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+
+		desired, _ := cmd.Flags().GetBool("desired")
+		if desired {
+			messages := make(chan string, 2)
 			token := client.Subscribe("devices/+/state/desired/delta", 1, func(_ MQTT.Client, msg MQTT.Message) {
 				messages <- string(msg.Payload())
 			})
@@ -550,6 +1560,77 @@ var mgmtDevIceStateMQTTCmd = &cobra.Command{
 	},
 }
 
+// mqttClientOptions makes MQTT client options for broker at --host (derived from API host by default),
+// authenticating with --basic if set, or with the certificate and key otherwise
+func mqttClientOptions(cmd *cobra.Command, cert_path, key_path string) (*MQTT.ClientOptions, error) {
+	opts := MQTT.NewClientOptions()
+
+	broker, _ := cmd.Flags().GetString("host")
+	if broker == "" {
+		broker = strings.Replace(
+			strings.Split(viper.GetString("infinimesh"), ":")[0],
+			"api.", "mqtt.", 1)
+	}
+
+	port, _ := cmd.Flags().GetString("port")
+	// Port may be given along with the host too
+	if host, p, err := net.SplitHostPort(broker); err == nil {
+		broker = host
+		if port == "" {
+			port = p
+		}
+	}
+	if basic, _ := cmd.Flags().GetString("basic"); basic != "" {
+		cred := strings.Split(basic, ":")
+		opts.SetUsername(cred[0])
+		opts.SetPassword(cred[1])
+
+		if port == "" {
+			port = "1883"
+		}
+		broker = "mqtt://" + broker + ":" + port
+	} else {
+		if cert_path == "" {
+			return nil, errors.New("no certificate given")
+		}
+		if key_path == "" {
+			return nil, errors.New("no key given")
+		}
+
+		cert, err := tls.LoadX509KeyPair(cert_path, key_path)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.SetTLSConfig(&tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			ClientAuth:         tls.NoClientCert,
+			ClientCAs:          nil,
+			InsecureSkipVerify: true,
+		})
+
+		if port == "" {
+			port = "8883"
+		}
+		broker = "mqtts://" + broker + ":" + port
+	}
+
+	opts.AddBroker(broker)
+
+	client_id, _ := cmd.Flags().GetString("client-id")
+	opts.SetClientID(client_id)
+	return opts, nil
+}
+
+// printFingerprint prints certificate fingerprint same way as PrintSingleDevice
+func printFingerprint(label string, cert *devpb.Certificate) {
+	if cert == nil {
+		fmt.Printf("%s: -\n", label)
+		return
+	}
+	fmt.Printf("%s:\n  Algorythm: %s\n  Hash: %s\n", label, cert.Algorithm, hex.EncodeToString(cert.Fingerprint))
+}
+
 func PrintSingleDevice(d *devpb.Device) {
 	fmt.Printf("UUID: %s\n", d.Uuid)
 	fmt.Printf("Title: %s\n", d.Title)
@@ -561,8 +1642,7 @@ func PrintSingleDevice(d *devpb.Device) {
 	}
 	fmt.Printf("Tags: %s\n", tags)
 
-	fingerprint := hex.EncodeToString(d.Certificate.Fingerprint)
-	fmt.Printf("Fingerprint:\n  Algorythm: %s\n  Hash: %s\n", d.Certificate.Algorithm, fingerprint)
+	printFingerprint("Fingerprint", d.Certificate)
 }
 
 func PrintSingleDeviceState(state *shadowpb.Shadow) {
@@ -571,67 +1651,83 @@ func PrintSingleDeviceState(state *shadowpb.Shadow) {
 	t.AppendRow(table.Row{"Device", state.Device})
 	t.AppendHeader(table.Row{"State", "Reported", "Desired"})
 
-	var reported []byte
-	var reported_time string
-	if state.Reported == nil {
-		reported = []byte("{}")
-		reported_time = "-"
-	} else {
-		reported, _ = state.Reported.Data.MarshalJSON()
-		reported_time = state.Reported.Timestamp.AsTime().String()
-	}
-
-	var desired []byte
-	var desired_time string
-	if state.Desired == nil {
-		desired = []byte("{}")
-		desired_time = "-"
-	} else {
-		desired, _ = state.Desired.Data.MarshalJSON()
-		desired_time = state.Desired.Timestamp.AsTime().String()
-	}
-	t.AppendRow(table.Row{"Data", string(reported), string(desired)})
-	t.AppendRow(table.Row{"Timestamp", reported_time, desired_time})
+	t.AppendRow(table.Row{"Data", stateData(state.Reported), stateData(state.Desired)})
+	t.AppendRow(table.Row{"Timestamp", stateTimestamp(state.Reported), stateTimestamp(state.Desired)})
 
 	t.Render()
 }
 
-func PrintDevicesPool(pool []*devpb.Device) {
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"UUID", "Title", "Enabled", "Tags"})
+func devicesTable(pool []*devpb.Device) *Table {
+	return NewTable("device", pool, (*devpb.Device).GetUuid,
+		Column[*devpb.Device]{Name: "UUID", Value: func(dev *devpb.Device) interface{} { return dev.Uuid }},
+		Column[*devpb.Device]{Name: "Title", Value: func(dev *devpb.Device) interface{} { return dev.Title }},
+		Column[*devpb.Device]{Name: "Enabled", Value: func(dev *devpb.Device) interface{} { return dev.Enabled }},
+		Column[*devpb.Device]{Name: "Tags", Value: func(dev *devpb.Device) interface{} {
+			tags := strings.Join(dev.Tags, ",")
+			if tags == "" {
+				tags = "-"
+			}
+			return tags
+		}},
+		Column[*devpb.Device]{Name: "Basic", Wide: true, Value: func(dev *devpb.Device) interface{} { return dev.BasicEnabled }},
+		Column[*devpb.Device]{Name: "Access", Wide: true, Value: func(dev *devpb.Device) interface{} { return accessString(dev.Access) }},
+		Column[*devpb.Device]{Name: "Fingerprint", Wide: true, Value: func(dev *devpb.Device) interface{} {
+			return hex.EncodeToString(dev.GetCertificate().GetFingerprint())
+		}},
+	).Sort(table.SortBy{Name: "UUID", Mode: table.Asc})
+}
 
-	rows := make([]table.Row, len(pool))
-	for i, dev := range pool {
-		tags := strings.Join(dev.Tags, ",")
-		if tags == "" {
-			tags = "-"
-		}
-		rows[i] = table.Row{dev.Uuid, dev.Title, dev.Enabled, tags}
+// stateData renders State data as JSON, {} if empty
+func stateData(state *shadowpb.State) string {
+	if state == nil || state.Data == nil {
+		return "{}"
 	}
-	t.AppendRows(rows)
+	data, _ := state.Data.MarshalJSON()
+	return string(data)
+}
 
-	t.SortBy([]table.SortBy{
-		{Name: "UUID", Mode: table.Asc},
-	})
+// stateTimestamp renders State timestamp, - if empty
+func stateTimestamp(state *shadowpb.State) string {
+	if state == nil || state.Timestamp == nil {
+		return "-"
+	}
+	return state.Timestamp.AsTime().String()
+}
 
-	t.AppendFooter(table.Row{"", "", "Total Found", len(pool)}, table.RowConfig{AutoMerge: true})
-	t.Render()
+func shadowsTable(pool []*shadowpb.Shadow) *Table {
+	return NewTable("shadow", pool, func(s *shadowpb.Shadow) string { return s.Device },
+		Column[*shadowpb.Shadow]{Name: "Device", Value: func(s *shadowpb.Shadow) interface{} { return s.Device }},
+		Column[*shadowpb.Shadow]{Name: "Reported", Value: func(s *shadowpb.Shadow) interface{} { return stateData(s.Reported) }},
+		Column[*shadowpb.Shadow]{Name: "Desired", Value: func(s *shadowpb.Shadow) interface{} { return stateData(s.Desired) }},
+		Column[*shadowpb.Shadow]{Name: "Reported At", Wide: true, Value: func(s *shadowpb.Shadow) interface{} { return stateTimestamp(s.Reported) }},
+		Column[*shadowpb.Shadow]{Name: "Desired At", Wide: true, Value: func(s *shadowpb.Shadow) interface{} { return stateTimestamp(s.Desired) }},
+	)
 }
 
 func init() {
 
-	listDevicesCmd.Flags().String("ns", "", "Namespace to list devices from")
+	listDevicesCmd.Flags().String("ns", "", "Namespace to list devices from (defaults to context namespace)")
+	addSelectorFlags(listDevicesCmd)
+	addListFlags(devicesCmd, listDevicesCmd)
+	addWatchFlags(devicesCmd, listDevicesCmd)
 	devicesCmd.AddCommand(listDevicesCmd)
 
 	devicesCmd.AddCommand(getDeviceCmd)
 
 	makeDeviceTokenCmd.Flags().Bool("allow-post", false, "Allow posting devices states")
+	addSelectorFlags(makeDeviceTokenCmd)
 	devicesCmd.AddCommand(makeDeviceTokenCmd)
 
 	createDeviceCmd.Flags().String("crt", "", "Path to certificate file")
-	createDeviceCmd.Flags().StringP("namespace", "n", "", "Namespace to create device in")
+	createDeviceCmd.Flags().StringP("namespace", "n", "", "Namespace to create device in (defaults to context namespace)")
 	createDeviceCmd.Flags().Bool("soft", false, "Create device without certificate")
+	createDeviceCmd.Flags().StringP("file", "f", "", "Create devices in bulk from CSV or multi-document YAML file")
+	createDeviceCmd.Flags().Int("concurrency", 4, "How many devices to create at once in bulk")
+	createDeviceCmd.Flags().String("report", "", "Path to write bulk report to (defaults to <file>.report.csv)")
+	createDeviceCmd.Flags().String("resume", "", "Report of the previous bulk run, rows created then are skipped")
+	createDeviceCmd.Flags().Bool("gen-cert", false, "Generate key pair and self-signed certificate for the device(s)")
+	addCertGenFlags(createDeviceCmd)
+	createDeviceCmd.MarkFlagsMutuallyExclusive("gen-cert", "crt", "soft")
 	devicesCmd.AddCommand(createDeviceCmd)
 
 	hostname, err := os.Hostname()
@@ -641,7 +1737,8 @@ func init() {
 
 	mgmtDevIceStateMQTTCmd.Flags().StringP("crt", "c", "", "Path to certificate file")
 	mgmtDevIceStateMQTTCmd.Flags().StringP("key", "k", "", "Path to private key file")
-	mgmtDevIceStateMQTTCmd.Flags().String("host", "", "MQTT broker Host and Port")
+	mgmtDevIceStateMQTTCmd.Flags().String("host", "", "MQTT broker host, optionally with port")
+	mgmtDevIceStateMQTTCmd.Flags().String("port", "", "MQTT broker port (defaults to 8883, or 1883 with --basic)")
 	mgmtDevIceStateMQTTCmd.Flags().StringP("basic", "b", "", "MQTT Basic Auth string (login:pass)")
 	mgmtDevIceStateMQTTCmd.Flags().StringP("client-id", "i", hostname, "MQTT client id")
 	mgmtDevIceStateMQTTCmd.Flags().StringP("report", "r", "", "Report Device state")
@@ -655,9 +1752,58 @@ func init() {
 	mgmtDeviceStateCmd.Flags().StringP("report", "r", "", "Report Device state")
 	mgmtDeviceStateCmd.Flags().String("remove", "", "Remove Device state key as <reported|desired>.<key>")
 	mgmtDeviceStateCmd.Flags().StringP("token", "t", "", "Device token(new would be obtained if not present)")
+	addSelectorFlags(mgmtDeviceStateCmd)
+	addConcurrencyFlags(mgmtDeviceStateCmd)
 	devicesCmd.AddCommand(mgmtDeviceStateCmd)
 
+	updateDeviceCmd.Flags().StringP("file", "f", "", "Device template.[json|yaml] to replace the device with")
+	updateDeviceCmd.Flags().String("title", "", "New device title")
+	updateDeviceCmd.Flags().StringSlice("set-tags", nil, "Replace device tags")
+	updateDeviceCmd.Flags().StringSlice("add-tag", nil, "Tag(s) to add")
+	updateDeviceCmd.Flags().StringSlice("remove-tag", nil, "Tag(s) to remove")
+	updateDeviceCmd.Flags().BoolP("yes", "y", false, "Don't ask for confirmation")
+	updateDeviceCmd.Flags().Bool("dry-run", false, "Only show the changes")
+	addSelectorFlags(updateDeviceCmd)
+	addConcurrencyFlags(updateDeviceCmd)
+	devicesCmd.AddCommand(updateDeviceCmd)
+
+	deleteDeviceCmd.Flags().BoolP("yes", "y", false, "Don't ask for confirmation")
+	deleteDeviceCmd.Flags().Bool("dry-run", false, "Only show what would be deleted")
+	addSelectorFlags(deleteDeviceCmd)
+	addConcurrencyFlags(deleteDeviceCmd)
+	devicesCmd.AddCommand(deleteDeviceCmd)
+
+	rotateCertDeviceCmd.Flags().String("crt", "", "Path to new certificate file")
+	rotateCertDeviceCmd.Flags().String("key", "", "Path to new certificate private key, to verify MQTT connection with")
+	rotateCertDeviceCmd.Flags().Bool("gen-cert", false, "Generate new key pair and self-signed certificate")
+	addCertGenFlags(rotateCertDeviceCmd)
+	rotateCertDeviceCmd.Flags().Bool("verify-mqtt", false, "Verify new certificate connects to MQTT broker, restore old one if it doesn't")
+	rotateCertDeviceCmd.Flags().String("host", "", "MQTT broker host, optionally with port")
+	rotateCertDeviceCmd.Flags().String("port", "", "MQTT broker port (defaults to 8883)")
+	rotateCertDeviceCmd.Flags().StringP("client-id", "i", hostname, "MQTT client id")
+	rotateCertDeviceCmd.Flags().Duration("mqtt-timeout", 10*time.Second, "How long to wait for MQTT connection")
+	rotateCertDeviceCmd.MarkFlagsMutuallyExclusive("crt", "gen-cert")
+	devicesCmd.AddCommand(rotateCertDeviceCmd)
+
+	whoisDeviceCmd.Flags().String("crt", "", "Path to device certificate")
+	whoisDeviceCmd.Flags().String("fingerprint", "", "Device certificate SHA-256 fingerprint in hex (: separators are allowed)")
+	whoisDeviceCmd.MarkFlagsMutuallyExclusive("crt", "fingerprint")
+	devicesCmd.AddCommand(whoisDeviceCmd)
+
+	certsDevicesCmd.Flags().String("ns", "", "Namespace to list devices certificates from (defaults to context namespace)")
+	certsDevicesCmd.Flags().String("expiring-within", "", "Only list certificates expiring within given time, e.g. 30d, and fail if there are any")
+	addListFlags(certsDevicesCmd)
+	devicesCmd.AddCommand(certsDevicesCmd)
+
+	toggleDeviceCmd.Flags().Bool("enable", false, "Enable devices, skipping enabled ones")
+	toggleDeviceCmd.Flags().Bool("disable", false, "Disable devices, skipping disabled ones")
+	toggleDeviceCmd.Flags().Bool("dry-run", false, "Only show what would be toggled")
+	toggleDeviceCmd.MarkFlagsMutuallyExclusive("enable", "disable")
+	addSelectorFlags(toggleDeviceCmd)
+	addConcurrencyFlags(toggleDeviceCmd)
 	devicesCmd.AddCommand(toggleDeviceCmd)
+	addSelectorFlags(patchConfigDeviceCmd)
+	addConcurrencyFlags(patchConfigDeviceCmd)
 	devicesCmd.AddCommand(patchConfigDeviceCmd)
 
 	rootCmd.AddCommand(devicesCmd)
@@ -0,0 +1,166 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit codes, see README
+const (
+	EXIT_OK                = 0
+	EXIT_ERROR             = 1
+	EXIT_USAGE             = 2
+	EXIT_INVALID_ARGUMENT  = 3
+	EXIT_NOT_FOUND         = 4
+	EXIT_ALREADY_EXISTS    = 5
+	EXIT_PERMISSION_DENIED = 6
+	EXIT_UNAUTHENTICATED   = 7
+	EXIT_UNAVAILABLE       = 8
+	EXIT_TIMEOUT           = 9
+	EXIT_SERVER_ERROR      = 10
+	EXIT_CERTS_EXPIRING    = 11
+)
+
+// EXIT_CODES maps gRPC status codes to exit codes, codes not listed exit with EXIT_ERROR
+var EXIT_CODES = map[codes.Code]int{
+	codes.InvalidArgument:    EXIT_INVALID_ARGUMENT,
+	codes.FailedPrecondition: EXIT_INVALID_ARGUMENT,
+	codes.OutOfRange:         EXIT_INVALID_ARGUMENT,
+	codes.NotFound:           EXIT_NOT_FOUND,
+	codes.AlreadyExists:      EXIT_ALREADY_EXISTS,
+	codes.PermissionDenied:   EXIT_PERMISSION_DENIED,
+	codes.Unauthenticated:    EXIT_UNAUTHENTICATED,
+	codes.Unavailable:        EXIT_UNAVAILABLE,
+	codes.ResourceExhausted:  EXIT_UNAVAILABLE,
+	codes.DeadlineExceeded:   EXIT_TIMEOUT,
+	codes.Internal:           EXIT_SERVER_ERROR,
+	codes.Unknown:            EXIT_SERVER_ERROR,
+	codes.Unimplemented:      EXIT_SERVER_ERROR,
+	codes.DataLoss:           EXIT_SERVER_ERROR,
+}
+
+// usageError is returned on invalid flags, exits with EXIT_USAGE
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// exitCodeError lets commands exit with specific code, e.g. when some of the results are negative
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e exitCodeError) Error() string { return e.err.Error() }
+func (e exitCodeError) Unwrap() error { return e.err }
+
+// errorHint suggests what to do about the error
+func errorHint(code codes.Code) string {
+	switch code {
+	case codes.Unauthenticated:
+		return fmt.Sprintf("token is missing, invalid or expired, run inf login <host:port> <login> --context %s", infContext)
+	case codes.PermissionDenied:
+		return "your Account doesn't have enough Access to the resource, check inf namespaces"
+	case codes.Unavailable:
+		return "server is unreachable, check the host (inf context show) and your network"
+	case codes.DeadlineExceeded:
+		return "server didn't respond in time, try increasing --timeout"
+	}
+	return ""
+}
+
+// CLIError is the structured representation of the command error
+type CLIError struct {
+	Code     string        `json:"code"`
+	ExitCode int           `json:"exit_code"`
+	Message  string        `json:"message"`
+	Details  []interface{} `json:"details,omitempty"`
+	Hint     string        `json:"hint,omitempty"`
+}
+
+// makeCLIError classifies the error by gRPC status or known CLI errors
+func makeCLIError(err error) *CLIError {
+	var usage usageError
+	var exit exitCodeError
+	switch {
+	case errors.As(err, &usage):
+		return &CLIError{Code: "Usage", ExitCode: EXIT_USAGE, Message: err.Error()}
+	case errors.As(err, &exit):
+		return &CLIError{Code: "Error", ExitCode: exit.code, Message: err.Error()}
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return &CLIError{Code: "Error", ExitCode: EXIT_ERROR, Message: err.Error()}
+	}
+
+	res := &CLIError{
+		Code:     s.Code().String(),
+		ExitCode: EXIT_ERROR,
+		Message:  s.Message(),
+		Hint:     errorHint(s.Code()),
+	}
+	if code, ok := EXIT_CODES[s.Code()]; ok {
+		res.ExitCode = code
+	}
+	for _, detail := range s.Details() {
+		if e, ok := detail.(error); ok {
+			detail = e.Error()
+		}
+		res.Details = append(res.Details, detail)
+	}
+	return res
+}
+
+// handleError prints the error as requested by output format and returns exit code
+func handleError(cmd *cobra.Command, err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+
+	e := makeCLIError(err)
+	if cmd != nil && outputFormat(cmd) == OUTPUT_JSON {
+		bytes, merr := marshalJson(map[string]interface{}{"error": e})
+		if merr == nil {
+			fmt.Fprintln(os.Stderr, string(bytes))
+			return e.ExitCode
+		}
+	}
+
+	if e.Code == "Error" || e.Code == "Usage" {
+		fmt.Fprintln(os.Stderr, "Error:", e.Message)
+	} else {
+		fmt.Fprintf(os.Stderr, "Error (%s): %s\n", e.Code, e.Message)
+	}
+	for _, detail := range e.Details {
+		if bytes, err := marshalJson(detail); err == nil {
+			fmt.Fprintln(os.Stderr, "  Details:", string(bytes))
+		}
+	}
+	if e.Hint != "" {
+		fmt.Fprintln(os.Stderr, "Hint:", e.Hint)
+	}
+	return e.ExitCode
+}
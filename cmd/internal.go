@@ -17,10 +17,9 @@ package cmd
 
 import (
 	"context"
-	"os"
+	"sort"
 
 	pb "github.com/infinimesh/proto/node"
-	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 )
 
@@ -53,26 +52,22 @@ var ldapProvidersCmd = &cobra.Command{
 			return err
 		}
 
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
+		keys := make([]string, 0, len(r.Providers))
+		for key := range r.Providers {
+			keys = append(keys, key)
 		}
+		sort.Strings(keys)
 
-		t := table.NewWriter()
-		t.SetOutputMirror(os.Stdout)
-		t.AppendHeader(table.Row{"Key", "Title"})
-
-		for key, title := range r.Providers {
-			t.AppendRow(table.Row{key, title})
-		}
-
-		t.Render()
-
-		return nil
+		return printOutput(cmd, r, NewTable("ldap", keys, func(key string) string { return key },
+			Column[string]{Name: "Key", Value: func(key string) interface{} { return key }},
+			Column[string]{Name: "Title", Value: func(key string) interface{} { return r.Providers[key] }},
+		).ListedIn("providers"))
 	},
 }
 
 func init() {
 
+	addListFlags(ldapProvidersCmd)
 	interalServiceCmd.AddCommand(ldapProvidersCmd)
 
 	rootCmd.AddCommand(interalServiceCmd)
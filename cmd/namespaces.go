@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"context"
-	"os"
 
 	pb "github.com/infinimesh/proto/node"
 	accesspb "github.com/infinimesh/proto/node/access"
@@ -53,17 +52,13 @@ var listNsCmd = &cobra.Command{
 			return err
 		}
 
-		r, err := client.List(ctx, &pb.EmptyMessage{})
-		if err != nil {
-			return err
-		}
-
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
-		}
-
-		PrintNamespacesPool(r.Namespaces)
-		return nil
+		return printList(cmd, func() (interface{}, *Table, error) {
+			r, err := client.List(ctx, &pb.EmptyMessage{})
+			if err != nil {
+				return nil, nil, err
+			}
+			return r, namespacesTable(r.Namespaces).ListedIn("namespaces"), nil
+		})
 	},
 }
 
@@ -79,71 +74,55 @@ var joinsNsCmd = &cobra.Command{
 			return err
 		}
 
-		r, err := client.Joins(ctx, &nspb.Namespace{Uuid: args[0]})
-		if err != nil {
-			return err
-		}
-
-		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
-			return printJsonResponse(r)
-		}
-
-		PrintNamespaceJoins(r.Accounts)
-		return nil
+		return printList(cmd, func() (interface{}, *Table, error) {
+			r, err := client.Joins(ctx, &nspb.Namespace{Uuid: args[0]})
+			if err != nil {
+				return nil, nil, err
+			}
+			return r, namespaceJoinsTable(r.Accounts).ListedIn("accounts"), nil
+		})
 	},
 }
 
-func PrintNamespacesPool(pool []*nspb.Namespace) {
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"UUID", "Title", "Access"})
-	t.SetColumnConfigs([]table.ColumnConfig{
-		{Number: 4, Hidden: true},
-	})
-
-	rows := make([]table.Row, len(pool))
-	for i, ns := range pool {
-		access := ns.Access.Level.String()
-		if ns.Access.Role == accesspb.Role_OWNER {
-			access += " (owner)"
-		}
-		rows[i] = table.Row{ns.Uuid, ns.Title, access, int(ns.Access.Level) + int(ns.Access.Role)}
+// accessString describes Access level, marking owned resources
+func accessString(access *accesspb.Access) string {
+	if access == nil {
+		return "-"
 	}
-	t.AppendRows(rows)
+	res := access.Level.String()
+	if access.Role == accesspb.Role_OWNER {
+		res += " (owner)"
+	}
+	return res
+}
 
-	t.SortBy([]table.SortBy{
-		{Number: 4, Mode: table.DscNumeric},
-	})
-	t.AppendFooter(table.Row{"", "Total Found", len(pool)}, table.RowConfig{AutoMerge: true})
-	t.Render()
+// accessWeight orders resources by Access, owned first
+func accessWeight(access *accesspb.Access) int {
+	return int(access.GetLevel()) + int(access.GetRole())
 }
 
-func PrintNamespaceJoins(pool []*accpb.Account) {
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"UUID", "Title", "Access"})
-	t.SetColumnConfigs([]table.ColumnConfig{
-		{Number: 4, Hidden: true},
-	})
-
-	rows := make([]table.Row, len(pool))
-	for i, acc := range pool {
-		access := acc.Access.Level.String()
-		if acc.Access.Role == accesspb.Role_OWNER {
-			access += " (owner)"
-		}
-		rows[i] = table.Row{acc.Uuid, acc.Title, access, int(acc.Access.Level) + int(acc.Access.Role)}
-	}
-	t.AppendRows(rows)
+func namespacesTable(pool []*nspb.Namespace) *Table {
+	return NewTable("namespace", pool, (*nspb.Namespace).GetUuid,
+		Column[*nspb.Namespace]{Name: "UUID", Value: func(ns *nspb.Namespace) interface{} { return ns.Uuid }},
+		Column[*nspb.Namespace]{Name: "Title", Value: func(ns *nspb.Namespace) interface{} { return ns.Title }},
+		Column[*nspb.Namespace]{Name: "Access", Value: func(ns *nspb.Namespace) interface{} { return accessString(ns.Access) }},
+		Column[*nspb.Namespace]{Name: "Weight", Hidden: true, Value: func(ns *nspb.Namespace) interface{} { return accessWeight(ns.Access) }},
+	).Sort(table.SortBy{Number: 4, Mode: table.DscNumeric})
+}
 
-	t.SortBy([]table.SortBy{
-		{Number: 4, Mode: table.DscNumeric},
-	})
-	t.AppendFooter(table.Row{"", "Total Found", len(pool)}, table.RowConfig{AutoMerge: true})
-	t.Render()
+func namespaceJoinsTable(pool []*accpb.Account) *Table {
+	return NewTable("account", pool, (*accpb.Account).GetUuid,
+		Column[*accpb.Account]{Name: "UUID", Value: func(acc *accpb.Account) interface{} { return acc.Uuid }},
+		Column[*accpb.Account]{Name: "Title", Value: func(acc *accpb.Account) interface{} { return acc.Title }},
+		Column[*accpb.Account]{Name: "Access", Value: func(acc *accpb.Account) interface{} { return accessString(acc.Access) }},
+		Column[*accpb.Account]{Name: "Weight", Hidden: true, Value: func(acc *accpb.Account) interface{} { return accessWeight(acc.Access) }},
+	).Sort(table.SortBy{Number: 4, Mode: table.DscNumeric})
 }
 
 func init() {
+	addListFlags(nsCmd, listNsCmd, joinsNsCmd)
+	addWatchFlags(nsCmd, listNsCmd, joinsNsCmd)
+
 	nsCmd.AddCommand(listNsCmd)
 	nsCmd.AddCommand(joinsNsCmd)
 
@@ -0,0 +1,380 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats supported by -o/--output
+const (
+	OUTPUT_TABLE       = "table"
+	OUTPUT_WIDE        = "wide"
+	OUTPUT_JSON        = "json"
+	OUTPUT_YAML        = "yaml"
+	OUTPUT_CSV         = "csv"
+	OUTPUT_NAME        = "name"
+	OUTPUT_JSONPATH    = "jsonpath="
+	OUTPUT_GO_TEMPLATE = "go-template="
+)
+
+var OUTPUT_FORMATS = []string{OUTPUT_TABLE, OUTPUT_WIDE, OUTPUT_JSON, OUTPUT_YAML, OUTPUT_CSV, OUTPUT_NAME, OUTPUT_JSONPATH + "...", OUTPUT_GO_TEMPLATE + "..."}
+
+// validateOutputFormat checks format is one of OUTPUT_FORMATS
+func validateOutputFormat(format string) error {
+	switch format {
+	case OUTPUT_TABLE, OUTPUT_WIDE, OUTPUT_JSON, OUTPUT_YAML, OUTPUT_CSV, OUTPUT_NAME:
+		return nil
+	}
+	if strings.HasPrefix(format, OUTPUT_JSONPATH) || strings.HasPrefix(format, OUTPUT_GO_TEMPLATE) {
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q, supported are: %s", format, strings.Join(OUTPUT_FORMATS, ", "))
+}
+
+// outputFormat resolves output format from -o, --json, INF_OUTPUT and context in that order
+func outputFormat(cmd *cobra.Command) string {
+	if !cmd.Flags().Changed("output") {
+		if printJson, _ := cmd.Flags().GetBool("json"); printJson {
+			return OUTPUT_JSON
+		}
+	}
+	if format := viper.GetString("output"); format != "" {
+		return format
+	}
+	return OUTPUT_TABLE
+}
+
+// printOutput prints data in the requested output format, t is used for table, wide, csv and name formats
+// List flags (see addListFlags) are applied to the Table, resources filtered out are removed from data too
+func printOutput(cmd *cobra.Command, data interface{}, t *Table) error {
+	format := outputFormat(cmd)
+
+	changed, err := t.applyListFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if data, err = t.filteredData(data); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case format == OUTPUT_TABLE || format == OUTPUT_WIDE:
+		t.Render(format == OUTPUT_WIDE)
+	case format == OUTPUT_CSV:
+		t.Writer(true, false).RenderCSV()
+	case format == OUTPUT_NAME:
+		for _, row := range t.Rows {
+			fmt.Printf("%s/%s\n", t.Kind, row.Name)
+		}
+	case format == OUTPUT_JSON:
+		return printJsonResponse(data)
+	case format == OUTPUT_YAML:
+		return printYamlResponse(data)
+	case strings.HasPrefix(format, OUTPUT_JSONPATH):
+		obj, err := toGeneric(data)
+		if err != nil {
+			return err
+		}
+		res, err := jsonPath(strings.TrimPrefix(format, OUTPUT_JSONPATH), obj)
+		if err != nil {
+			return err
+		}
+		fmt.Println(res)
+	case strings.HasPrefix(format, OUTPUT_GO_TEMPLATE):
+		tmpl, err := template.New("output").Parse(strings.TrimPrefix(format, OUTPUT_GO_TEMPLATE))
+		if err != nil {
+			return fmt.Errorf("error parsing go-template: %w", err)
+		}
+		obj, err := toGeneric(data)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.Execute(os.Stdout, obj); err != nil {
+			return err
+		}
+		fmt.Println()
+	default:
+		return validateOutputFormat(format)
+	}
+	return nil
+}
+
+func printYamlResponse(data interface{}) error {
+	obj, err := toGeneric(data)
+	if err != nil {
+		return err
+	}
+	bytes, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(bytes))
+	return nil
+}
+
+// protojsonOptions makes protojson options out of --json-* flags
+func protojsonOptions() protojson.MarshalOptions {
+	return protojson.MarshalOptions{
+		UseProtoNames:   viper.GetBool("json-proto-names"),
+		EmitUnpopulated: viper.GetBool("json-emit-unpopulated"),
+	}
+}
+
+// marshalJson marshals data as JSON, protobuf messages (nested in slices and maps too) are marshaled with protojson
+func marshalJson(data interface{}) ([]byte, error) {
+	obj, err := protoToJson(protojsonOptions(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	if indent := viper.GetInt("json-indent"); indent > 0 {
+		return json.MarshalIndent(obj, "", strings.Repeat(" ", indent))
+	}
+	return json.Marshal(obj)
+}
+
+// protoToJson replaces protobuf messages in data with their protojson representation
+func protoToJson(opts protojson.MarshalOptions, data interface{}) (interface{}, error) {
+	if msg, ok := data.(proto.Message); ok {
+		bytes, err := opts.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(bytes), nil
+	}
+
+	val := reflect.ValueOf(data)
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return data, nil
+		}
+		if val.Kind() == reflect.Slice && val.IsNil() {
+			return nil, nil
+		}
+		res := make([]interface{}, val.Len())
+		for i := range res {
+			el, err := protoToJson(opts, val.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			res[i] = el
+		}
+		return res, nil
+	case reflect.Map:
+		if val.IsNil() {
+			return nil, nil
+		}
+		res := make(map[string]interface{}, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			el, err := protoToJson(opts, iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			res[fmt.Sprint(iter.Key().Interface())] = el
+		}
+		return res, nil
+	}
+	return data, nil
+}
+
+// toGeneric converts data to the same maps and slices it's represented with in json output
+func toGeneric(data interface{}) (interface{}, error) {
+	bytes, err := marshalJson(data)
+	if err != nil {
+		return nil, err
+	}
+	var obj interface{}
+	err = json.Unmarshal(bytes, &obj)
+	return obj, err
+}
+
+// jsonPath evaluates JSONPath template, like {.devices[*].uuid} or plain .devices[0].title
+// Fields, indexes (negative too), [*] and * wildcards are supported, multiple results are space separated
+func jsonPath(tmpl string, data interface{}) (string, error) {
+	if !strings.Contains(tmpl, "{") {
+		tmpl = "{" + tmpl + "}"
+	}
+
+	var out strings.Builder
+	for tmpl != "" {
+		start := strings.Index(tmpl, "{")
+		if start < 0 {
+			out.WriteString(tmpl)
+			break
+		}
+		end := strings.Index(tmpl[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unclosed jsonpath expression in %q", tmpl)
+		}
+		out.WriteString(tmpl[:start])
+
+		res, err := evalJsonPath(tmpl[start+1:start+end], data)
+		if err != nil {
+			return "", err
+		}
+		values := make([]string, len(res))
+		for i, v := range res {
+			values[i] = formatJsonValue(v)
+		}
+		out.WriteString(strings.Join(values, " "))
+
+		tmpl = tmpl[start+end+1:]
+	}
+	return out.String(), nil
+}
+
+// evalJsonPath returns all values found by the path, missing fields are skipped
+func evalJsonPath(path string, data interface{}) ([]interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	current := []interface{}{data}
+
+	for path != "" {
+		var next []interface{}
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			key := path[:end]
+			path = path[end:]
+			if key == "" {
+				continue
+			}
+			for _, v := range current {
+				next = append(next, jsonPathField(v, key)...)
+			}
+		case '[':
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in jsonpath %q", path)
+			}
+			key := path[1:end]
+			path = path[end+1:]
+			for _, v := range current {
+				res, err := jsonPathIndex(v, key)
+				if err != nil {
+					return nil, err
+				}
+				next = append(next, res...)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in jsonpath, expected . or [", path)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func jsonPathField(v interface{}, key string) []interface{} {
+	if key == "*" {
+		return jsonPathAll(v)
+	}
+	if obj, ok := v.(map[string]interface{}); ok {
+		if val, ok := obj[key]; ok {
+			return []interface{}{val}
+		}
+	}
+	return nil
+}
+
+func jsonPathIndex(v interface{}, key string) ([]interface{}, error) {
+	if key == "*" {
+		return jsonPathAll(v), nil
+	}
+	if strings.HasPrefix(key, "'") || strings.HasPrefix(key, "\"") {
+		return jsonPathField(v, strings.Trim(key, "'\"")), nil
+	}
+	i, err := strconv.Atoi(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jsonpath index [%s]", key)
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	if i < 0 {
+		i += len(arr)
+	}
+	if i < 0 || i >= len(arr) {
+		return nil, nil
+	}
+	return []interface{}{arr[i]}, nil
+}
+
+func jsonPathAll(v interface{}) []interface{} {
+	switch val := v.(type) {
+	case []interface{}:
+		return val
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		res := make([]interface{}, len(keys))
+		for i, k := range keys {
+			res[i] = val[k]
+		}
+		return res
+	}
+	return nil
+}
+
+func formatJsonValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case nil:
+		return ""
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bytes)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringP("output", "o", "", "Output format: "+strings.Join(OUTPUT_FORMATS, ", ")+" (default is context output or table)")
+	viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+
+	rootCmd.PersistentFlags().Int("json-indent", 0, "Indent json output with given number of spaces")
+	rootCmd.PersistentFlags().Bool("json-proto-names", false, "Use proto field names (snake_case) instead of lowerCamelCase in json output")
+	rootCmd.PersistentFlags().Bool("json-emit-unpopulated", false, "Include fields with default values in json output")
+	for _, flag := range []string{"json-indent", "json-proto-names", "json-emit-unpopulated"} {
+		viper.BindPFlag(flag, rootCmd.PersistentFlags().Lookup(flag))
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const jsonPathTestData = `{
+	"devices": [
+		{"uuid": "a", "title": "first", "enabled": true, "tags": ["x", "y"]},
+		{"uuid": "b", "title": "second", "enabled": false, "tags": []},
+		{"uuid": "c", "title": "third", "enabled": true, "config": {"n": 1}}
+	],
+	"total": 3,
+	"with.dot": "dotted"
+}`
+
+func TestJsonPath(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(jsonPathTestData), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tmpl    string
+		want    string
+		wantErr bool
+	}{
+		{tmpl: "{.devices[*].uuid}", want: "a b c"},
+		{tmpl: ".devices[0].title", want: "first"},
+		{tmpl: "$.devices[1].title", want: "second"},
+		{tmpl: "{.devices[-1].uuid}", want: "c"},
+		{tmpl: "{.devices[-3].uuid}", want: "a"},
+		{tmpl: "{.devices[-4].uuid}", want: ""},
+		{tmpl: "{.devices[3].uuid}", want: ""},
+		{tmpl: "{.devices[0].tags[-1]}", want: "y"},
+		{tmpl: "{.devices[1].tags[-1]}", want: ""},
+		{tmpl: "{.devices[*].enabled}", want: "true false true"},
+		{tmpl: "{.total}", want: "3"},
+		{tmpl: "{.devices[2].config}", want: `{"n":1}`},
+		{tmpl: "{.devices[0].tags}", want: `["x","y"]`},
+		{tmpl: "{.devices[*].missing}", want: ""},
+		{tmpl: "{.devices[*].config.n}", want: "1"},
+		{tmpl: "{.devices[2].config.*}", want: "1"},
+		{tmpl: "{['with.dot']}", want: "dotted"},
+		{tmpl: `{.devices[0]["uuid"]}`, want: "a"},
+		{tmpl: "{.total.x}", want: ""},
+		{tmpl: "{.total[0]}", want: ""},
+		{tmpl: "total: {.total}, first: {.devices[0].uuid}", want: "total: 3, first: a"},
+		{tmpl: "{.devices[x]}", wantErr: true},
+		{tmpl: "{.devices[0}", wantErr: true},
+		{tmpl: "{.devices", wantErr: true},
+		{tmpl: "{devices}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := jsonPath(tt.tmpl, data)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("jsonPath(%q) = %q, want error", tt.tmpl, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("jsonPath(%q) = %q, %v, want %q", tt.tmpl, got, err, tt.want)
+		}
+	}
+}
@@ -16,12 +16,15 @@ limitations under the License.
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
+	"math"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
 
 	"github.com/spf13/viper"
 )
@@ -34,6 +37,12 @@ var rootCmd = &cobra.Command{
 	Use:   "inf",
 	Short: "infinimesh Platform CLI",
 	RunE:  contextCmd.RunE,
+	// Errors are printed by handleError
+	SilenceErrors: true,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Args and flags are valid at this point, so usage isn't helpful anymore
+		cmd.SilenceUsage = true
+	},
 }
 
 var VERSION string
@@ -44,106 +53,120 @@ func Execute() {
 	if VERSION == "" {
 		VERSION = "dev"
 	}
-	cobra.CheckErr(rootCmd.Execute())
+	cmd, err := rootCmd.ExecuteC()
+	closeConnection()
+	if err != nil && cmd != nil && !cmd.SilenceUsage {
+		// Failed before the command has run, so arguments are wrong
+		err = usageError{err}
+	}
+	if code := handleError(cmd, err); code != EXIT_OK {
+		os.Exit(code)
+	}
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.default.infinimesh.yaml)")
-	rootCmd.PersistentFlags().StringVar(&infContext, "context", "", "Use a specific config context (default is default)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config document (default is $HOME/.infinimesh/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&infContext, "context", "", "Use a specific config context (default is current context)")
 	rootCmd.PersistentFlags().Bool("json", false, "Print output as json")
 	rootCmd.PersistentFlags().Bool("verbose", false, "Print additional info related to the CLI itself")
-
-	cobra.OnInitialize(initConfig)
-}
-
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		loadContext()
+	rootCmd.PersistentFlags().Duration("timeout", 30*time.Second, "Timeout for each API call (0 to wait forever)")
+	rootCmd.PersistentFlags().Int("retries", 3, "Times to retry API calls failed as Unavailable or ResourceExhausted (0-4)")
+	rootCmd.PersistentFlags().Duration("retry-backoff", 200*time.Millisecond, "Initial backoff between retries, doubled on each retry")
+	rootCmd.PersistentFlags().Duration("retry-max-backoff", 5*time.Second, "Max backoff between retries")
+	rootCmd.PersistentFlags().String("token-file", "", "Read token from file instead of the context")
+
+	for _, flag := range []string{"timeout", "retries", "retry-backoff", "retry-max-backoff", "token-file"} {
+		viper.BindPFlag(flag, rootCmd.PersistentFlags().Lookup(flag))
 	}
-
-	viper.AutomaticEnv() // read in environment variables that match
-
-	verbose, _ := rootCmd.Flags().GetBool("verbose")
-	// If a config file is found, read it in.
-	err := viper.ReadInConfig()
-	if err == nil && verbose {
-		fmt.Println("Using context: ", infContext)
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	for key, env := range ENV {
+		viper.BindEnv(key, env)
 	}
-}
-
-func loadContext() {
-	checkContext()
-
-	home, err := os.UserHomeDir()
-	cobra.CheckErr(err)
-
-	// Search config in home directory with name ".inf" (without extension).
-	viper.AddConfigPath(home)
-	viper.SetConfigType("yaml")
 
-	config_name := fmt.Sprintf(".%s.infinimesh", infContext)
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError{err}
+	})
 
-	viper.SetConfigName(config_name)
-
-	cfgFile = fmt.Sprintf("%s/%s.yaml", home, config_name)
+	cobra.OnInitialize(initConfig)
+}
 
-	if _, err := os.Stat(cfgFile); os.IsNotExist(err) {
-		if _, err := os.Create(cfgFile); err != nil { // perm 0666
-			fmt.Fprintln(os.Stderr, "Can't create default config file")
-			panic(err)
-		}
-	}
+// ENV maps settings to environment variables overriding them, see README
+var ENV = map[string]string{
+	"infinimesh":        "INF_HOST",
+	"token":             "INF_TOKEN",
+	"token-file":        "INF_TOKEN_FILE",
+	"insecure":          "INF_INSECURE",
+	"namespace":         "INF_NAMESPACE",
+	"output":            "INF_OUTPUT",
+	"tls.ca":            "INF_TLS_CA",
+	"tls.server-name":   "INF_TLS_SERVER_NAME",
+	"tls.skip-verify":   "INF_TLS_SKIP_VERIFY",
+	"tls.fingerprint":   "INF_TLS_FINGERPRINT",
+	"tls.client-cert":   "INF_TLS_CLIENT_CERT",
+	"tls.client-key":    "INF_TLS_CLIENT_KEY",
+	"tls.pkcs12":        "INF_TLS_PKCS12",
+	"timeout":           "INF_TIMEOUT",
+	"retries":           "INF_RETRIES",
+	"retry-backoff":     "INF_RETRY_BACKOFF",
+	"retry-max-backoff": "INF_RETRY_MAX_BACKOFF",
 }
 
-func checkContext() {
-	if infContext != "" {
-		return
+// initConfig reads in config document, ENV variables take precedence over it.
+func initConfig() {
+	if cfgFile == "" {
+		cfgFile = os.Getenv("INF_CONFIG")
+	}
+	if infContext == "" {
+		infContext = os.Getenv("INF_CONTEXT")
 	}
 
-	home, err := os.UserHomeDir()
+	conf, err := loadConfig()
 	cobra.CheckErr(err)
+	infConfig = conf
 
-	faulty_conf := false
-	profilesCfg := fmt.Sprintf("%s/.infinimesh.contexts", home)
-	if _, err := os.Stat(profilesCfg); os.IsNotExist(err) {
-		faulty_conf = true
-		if _, err := os.Create(profilesCfg); err != nil { // perm 0666
-			fmt.Fprintln(os.Stderr, "Can't create default contexts config file")
-			panic(err)
-		}
+	if infContext == "" {
+		infContext = infConfig.Current()
 	}
 
-	contexts := ContextConf{
-		Selected: "default",
-	}
-	profilesBytes, err := os.ReadFile(profilesCfg)
-	if err != nil || len(profilesBytes) == 0 {
-		faulty_conf = true
-	}
-	if err == nil {
-		if yaml.Unmarshal(profilesBytes, &contexts) != nil {
-			faulty_conf = true
+	verbose, _ := rootCmd.Flags().GetBool("verbose")
+	if ctx, ok := infConfig.Contexts[infContext]; ok {
+		cobra.CheckErr(viper.MergeConfigMap(ctx.settings(infContext)))
+		if verbose {
+			fmt.Println("Using context: ", infContext)
+			fmt.Println("Using config file:", configPath())
 		}
 	}
 
-	infContext = contexts.Selected
-
-	if faulty_conf {
-		r, _ := yaml.Marshal(contexts)
-		os.WriteFile(profilesCfg, r, 0640)
+	if viper.GetString("output") == "json" && !rootCmd.PersistentFlags().Changed("json") {
+		rootCmd.PersistentFlags().Set("json", "true")
 	}
 }
 
 func printJsonResponse(data interface{}) error {
-	bytes, err := json.Marshal(data)
+	bytes, err := marshalJson(data)
 	if err != nil {
 		return err
 	}
 	fmt.Println(string(bytes))
 	return nil
 }
+
+// parseDuration is time.ParseDuration also accepting days, like 30d
+func parseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		// Also rules out NaN and Inf, as well as durations overflowing int64
+		if err != nil || math.Abs(n*float64(24*time.Hour)) >= math.MaxInt64 || math.IsNaN(n) {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// globMatch reports whether s matches the pattern, where * matches any sequence and ? any single character
+func globMatch(pattern, s string) bool {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.MustCompile("(?s)^" + expr + "$").MatchString(s)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2022 Infinite Devices GmbH, Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "30d", want: 30 * 24 * time.Hour},
+		{in: "1.5d", want: 36 * time.Hour},
+		{in: "0d", want: 0},
+		{in: "-1d", want: -24 * time.Hour},
+		{in: "90m", want: 90 * time.Minute},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "d", wantErr: true},
+		{in: "xd", wantErr: true},
+		{in: "Infd", wantErr: true},
+		{in: "NaNd", wantErr: true},
+		{in: "1e9d", wantErr: true},
+		{in: "1d12h", wantErr: true},
+		{in: "30", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseDuration(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"sensor-*", "sensor-1", true},
+		{"sensor-*", "sensor-", true},
+		{"sensor-*", "my-sensor-1", false},
+		{"*-1", "sensor-1", true},
+		{"s*r*1", "sensor-1", true},
+		{"sensor-?", "sensor-1", true},
+		{"sensor-?", "sensor-10", false},
+		{"sensor-?", "sensor-", false},
+		{"?", "ü", true},
+		{"Sensor", "sensor", false},
+		{"a.b", "a.b", true},
+		{"a.b", "axb", false},
+		{"[ab]", "a", false},
+		{"[ab]", "[ab]", true},
+		{"(a|b)+", "(a|b)+", true},
+		{`a\*`, `a\x`, true},
+		{"*", "multi\nline", true},
+		{"a?b", "a\nb", true},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	pb "github.com/infinimesh/proto/node"
+	devpb "github.com/infinimesh/proto/node/devices"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Keys Devices can be selected by
+var SELECTOR_KEYS = []string{"uuid", "title", "tag", "enabled", "basic"}
+
+// selectorTerm is a single Selector condition, like tag=sensor, !tag=legacy or title~=pump-*
+type selectorTerm struct {
+	Key    string
+	Value  string
+	Glob   bool
+	Negate bool
+}
+
+// Selector matches Devices, all of the terms must match
+type Selector []selectorTerm
+
+// parseSelector parses comma separated terms as [!]<key><=|!=|~=><value>
+func parseSelector(expr string) (Selector, error) {
+	var sel Selector
+	for _, term := range strings.Split(expr, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		t := selectorTerm{}
+		if strings.HasPrefix(term, "!") {
+			t.Negate = true
+			term = term[1:]
+		}
+
+		// Term is split at the leftmost operator, so the value may contain any of them
+		op, pos := "", len(term)
+		for _, o := range TABLE_FILTER_OPS {
+			if i := strings.Index(term, o); i >= 0 && i < pos {
+				op, pos = o, i
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("invalid selector term %q, expected [!]<key><=|!=|~=><value>", term)
+		}
+		switch op {
+		case "~=":
+			t.Glob = true
+		case "!=":
+			t.Negate = !t.Negate
+		}
+		t.Key = strings.ToLower(strings.TrimSpace(term[:pos]))
+		t.Value = strings.TrimSpace(term[pos+len(op):])
+
+		known := false
+		for _, key := range SELECTOR_KEYS {
+			known = known || key == t.Key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown selector key %q, supported are: %s", t.Key, strings.Join(SELECTOR_KEYS, ", "))
+		}
+		if t.Key == "enabled" || t.Key == "basic" {
+			if _, err := strconv.ParseBool(t.Value); err != nil {
+				return nil, fmt.Errorf("selector %s expects true or false, got %q", t.Key, t.Value)
+			}
+		}
+
+		sel = append(sel, t)
+	}
+
+	if len(sel) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	return sel, nil
+}
+
+func (t selectorTerm) matchValue(value string) bool {
+	if t.Glob {
+		return globMatch(t.Value, value)
+	}
+	return value == t.Value
+}
+
+func (t selectorTerm) match(dev *devpb.Device) bool {
+	var res bool
+	switch t.Key {
+	case "uuid":
+		res = t.matchValue(dev.Uuid)
+	case "title":
+		res = t.matchValue(dev.Title)
+	case "tag":
+		for _, tag := range dev.Tags {
+			if t.matchValue(tag) {
+				res = true
+				break
+			}
+		}
+	case "enabled":
+		expected, _ := strconv.ParseBool(t.Value)
+		res = dev.Enabled == expected
+	case "basic":
+		expected, _ := strconv.ParseBool(t.Value)
+		res = dev.BasicEnabled == expected
+	}
+	return res != t.Negate
+}
+
+// Match tells whether Device matches all the terms
+func (s Selector) Match(dev *devpb.Device) bool {
+	for _, t := range s {
+		if !t.match(dev) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectDevices lists Devices in namespace (all accessible if empty) and returns ones matching the selector
+func selectDevices(ctx context.Context, client pb.DevicesServiceClient, sel Selector, ns string) ([]*devpb.Device, error) {
+	req := &pb.QueryRequest{}
+	if ns != "" {
+		req.Namespace = &ns
+	}
+
+	r, err := client.List(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*devpb.Device
+	for _, dev := range r.Devices {
+		if sel.Match(dev) {
+			res = append(res, dev)
+		}
+	}
+	return res, nil
+}
+
+// resolveDevices gets Devices given as arguments and selected by --selector
+// Devices which couldn't be fetched are returned as failed results
+func resolveDevices(cmd *cobra.Command, ctx context.Context, client pb.DevicesServiceClient, uuids []string) ([]*devpb.Device, []deviceResult, error) {
+	var devices []*devpb.Device
+	var failed []deviceResult
+	seen := make(map[string]bool)
+
+	for _, uuid := range uuids {
+		if seen[uuid] {
+			continue
+		}
+		seen[uuid] = true
+
+		dev, err := client.Get(ctx, &devpb.Device{Uuid: uuid})
+		if err != nil {
+			failed = append(failed, deviceResult{Uuid: uuid, Result: DEVICE_RESULT_FAILED, Error: makeCLIError(err).Message})
+			continue
+		}
+		devices = append(devices, dev)
+	}
+
+	if hasSelector(cmd) {
+		sel, err := commandSelector(cmd)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ns, _ := cmd.Flags().GetString("ns")
+		if ns == "" {
+			ns = viper.GetString("namespace")
+		}
+		selected, err := selectDevices(ctx, client, sel, ns)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, dev := range selected {
+			if !seen[dev.Uuid] {
+				seen[dev.Uuid] = true
+				devices = append(devices, dev)
+			}
+		}
+	}
+
+	return devices, failed, nil
+}
+
+// hasSelector tells whether Devices are selected with --selector
+func hasSelector(cmd *cobra.Command) bool {
+	expr, _ := cmd.Flags().GetString("selector")
+	return expr != ""
+}
+
+// commandSelector parses --selector, empty Selector matches all Devices
+func commandSelector(cmd *cobra.Command) (Selector, error) {
+	expr, _ := cmd.Flags().GetString("selector")
+	if expr == "" {
+		return nil, nil
+	}
+	sel, err := parseSelector(expr)
+	if err != nil {
+		return nil, usageError{err}
+	}
+	return sel, nil
+}
+
+// runOnDevices applies op to each Device, --concurrency at a time, results are in Devices order
+// op returns the result to report, OK if empty
+func runOnDevices(cmd *cobra.Command, devices []*devpb.Device, op func(dev *devpb.Device) (string, error)) []deviceResult {
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]deviceResult, len(devices))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, dev := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, dev *devpb.Device) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			res := deviceResult{Uuid: dev.Uuid, Title: dev.Title, Result: DEVICE_RESULT_OK}
+			if result, err := op(dev); err != nil {
+				res.Result = DEVICE_RESULT_FAILED
+				res.Error = makeCLIError(err).Message
+			} else if result != "" {
+				res.Result = result
+			}
+			results[i] = res
+		}(i, dev)
+	}
+	wg.Wait()
+	return results
+}
+
+// Device operation results
+const (
+	DEVICE_RESULT_OK      = "OK"
+	DEVICE_RESULT_DRY_RUN = "Dry Run"
+	DEVICE_RESULT_SKIPPED = "Skipped"
+	DEVICE_RESULT_FAILED  = "Failed"
+)
+
+// deviceResult is the outcome of the operation on a single Device
+type deviceResult struct {
+	Uuid   string `json:"uuid"`
+	Title  string `json:"title"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+func deviceResultsTable(results []deviceResult) *Table {
+	return NewTable("device", results, func(res deviceResult) string { return res.Uuid },
+		Column[deviceResult]{Name: "UUID", Value: func(res deviceResult) interface{} { return res.Uuid }},
+		Column[deviceResult]{Name: "Title", Value: func(res deviceResult) interface{} { return res.Title }},
+		Column[deviceResult]{Name: "Result", Value: func(res deviceResult) interface{} { return res.Result }},
+		Column[deviceResult]{Name: "Error", Value: func(res deviceResult) interface{} { return res.Error }},
+	)
+}
+
+// printDeviceResults prints results table and fails if any of the results is failed
+func printDeviceResults(cmd *cobra.Command, results []deviceResult) error {
+	if err := printOutput(cmd, results, deviceResultsTable(results)); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, res := range results {
+		if res.Result == DEVICE_RESULT_FAILED {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d Devices failed", failed, len(results))
+	}
+	return nil
+}
+
+// addSelectorFlags adds flags to select Devices
+func addSelectorFlags(cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		// Invalid selector is reported before connecting, after the command's own PreRunE if any
+		preRunE := cmd.PreRunE
+		cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+			if preRunE != nil {
+				if err := preRunE(cmd, args); err != nil {
+					return err
+				}
+			}
+			_, err := commandSelector(cmd)
+			return err
+		}
+		cmd.Flags().StringP("selector", "l", "", "Select Devices as [!]<key><=|!=|~=><value>, comma separated, keys: "+strings.Join(SELECTOR_KEYS, ", ")+", e.g. tag=sensor,!tag=legacy,title~=pump-*")
+		if cmd.Flags().Lookup("ns") == nil {
+			cmd.Flags().String("ns", "", "Namespace to select Devices from (defaults to context namespace)")
+		}
+	}
+}
+
+// addConcurrencyFlags adds flag limiting how many Devices runOnDevices processes at once
+func addConcurrencyFlags(cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		cmd.Flags().Int("concurrency", 8, "How many Devices to process at once")
+	}
+}
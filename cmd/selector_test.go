@@ -0,0 +1,127 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	devpb "github.com/infinimesh/proto/node/devices"
+	"github.com/spf13/cobra"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    Selector
+		wantErr bool
+	}{
+		{expr: "tag=sensor", want: Selector{{Key: "tag", Value: "sensor"}}},
+		{expr: "tag==sensor", want: Selector{{Key: "tag", Value: "sensor"}}},
+		{expr: "tag!=legacy", want: Selector{{Key: "tag", Value: "legacy", Negate: true}}},
+		{expr: "!tag=legacy", want: Selector{{Key: "tag", Value: "legacy", Negate: true}}},
+		{expr: "!tag!=legacy", want: Selector{{Key: "tag", Value: "legacy"}}},
+		{expr: "title~=pump-*", want: Selector{{Key: "title", Value: "pump-*", Glob: true}}},
+		{expr: "!title~=pump-*", want: Selector{{Key: "title", Value: "pump-*", Glob: true, Negate: true}}},
+		{expr: " Title = pump , enabled=true,", want: Selector{{Key: "title", Value: "pump"}, {Key: "enabled", Value: "true"}}},
+		// Leftmost operator splits the term, the rest is the value
+		{expr: "title=a~=b", want: Selector{{Key: "title", Value: "a~=b"}}},
+		{expr: "title=a!=b", want: Selector{{Key: "title", Value: "a!=b"}}},
+		{expr: "title~=a=b", want: Selector{{Key: "title", Value: "a=b", Glob: true}}},
+		{expr: "title!=a=b", want: Selector{{Key: "title", Value: "a=b", Negate: true}}},
+		{expr: "title=!a", want: Selector{{Key: "title", Value: "!a"}}},
+		{expr: "title=", want: Selector{{Key: "title", Value: ""}}},
+		{expr: "basic=false", want: Selector{{Key: "basic", Value: "false"}}},
+		{expr: "", wantErr: true},
+		{expr: " , ", wantErr: true},
+		{expr: "tag", wantErr: true},
+		{expr: "!tag", wantErr: true},
+		{expr: "=x", wantErr: true},
+		{expr: "owner=me", wantErr: true},
+		{expr: "enabled=yes", wantErr: true},
+		{expr: "tag=a,title", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSelector(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSelector(%q) = %v, want error", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSelector(%q) = %+v, %v, want %+v", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	dev := &devpb.Device{Uuid: "0a1b", Title: "pump-1", Tags: []string{"sensor", "floor-2"}, Enabled: true}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"uuid=0a1b", true},
+		{"title=pump-1", true},
+		{"title=Pump-1", false},
+		{"title~=pump-*", true},
+		{"!title~=pump-*", false},
+		{"tag=sensor", true},
+		{"tag~=floor-?", true},
+		{"tag!=legacy", true},
+		{"tag!=sensor", false},
+		{"enabled=true", true},
+		{"enabled=false", false},
+		{"basic=false", true},
+		{"tag=sensor,enabled=true", true},
+		{"tag=sensor,enabled=false", false},
+	}
+	for _, tt := range tests {
+		sel, err := parseSelector(tt.expr)
+		if err != nil {
+			t.Fatalf("parseSelector(%q): %v", tt.expr, err)
+		}
+		if got := sel.Match(dev); got != tt.want {
+			t.Errorf("%q matches %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestSelectorFlags(t *testing.T) {
+	cmds := []*cobra.Command{
+		listDevicesCmd, makeDeviceTokenCmd, mgmtDeviceStateCmd, updateDeviceCmd,
+		deleteDeviceCmd, toggleDeviceCmd, patchConfigDeviceCmd,
+	}
+	for _, cmd := range cmds {
+		if err := cmd.PreRunE(cmd, nil); err != nil {
+			t.Errorf("%s without --selector: %v", cmd.CommandPath(), err)
+		}
+		sel, err := commandSelector(cmd)
+		if err != nil || sel != nil {
+			t.Errorf("%s without --selector: got %v, %v, want all Devices", cmd.CommandPath(), sel, err)
+		}
+		if !sel.Match(&devpb.Device{Uuid: "0a1b"}) {
+			t.Errorf("%s without --selector doesn't match all Devices", cmd.CommandPath())
+		}
+
+		cmd.Flags().Set("selector", "bogus")
+		err = cmd.PreRunE(cmd, nil)
+		if _, ok := err.(usageError); !ok {
+			t.Errorf("%s --selector bogus: got %v, want usage error", cmd.CommandPath(), err)
+		}
+		cmd.Flags().Set("selector", "")
+	}
+}
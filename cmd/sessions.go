@@ -0,0 +1,182 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	pb "github.com/infinimesh/proto/node"
+	"github.com/infinimesh/proto/node/sessions"
+	"github.com/spf13/cobra"
+)
+
+// sessionsPruneFilter selects Sessions to revoke, all given conditions must match
+type sessionsPruneFilter struct {
+	All           bool
+	OlderThan     time.Duration
+	IdleFor       time.Duration
+	ClientMatches string
+}
+
+func (f *sessionsPruneFilter) empty() bool {
+	return !f.All && f.OlderThan == 0 && f.IdleFor == 0 && f.ClientMatches == ""
+}
+
+// match tells whether Session should be pruned, current Session is never pruned
+func (f *sessionsPruneFilter) match(sess *sessions.Session, act *sessions.Activity, now time.Time) bool {
+	if sess.GetCurrent() {
+		return false
+	}
+	if f.OlderThan > 0 && now.Sub(sess.GetCreated().AsTime()) < f.OlderThan {
+		return false
+	}
+	if f.IdleFor > 0 {
+		// Never seen Sessions are idle since they've been created
+		last := sess.GetCreated().AsTime()
+		if ts, ok := act.GetLastSeen()[sess.GetId()]; ok {
+			last = ts.AsTime()
+		}
+		if now.Sub(last) < f.IdleFor {
+			return false
+		}
+	}
+	if f.ClientMatches != "" && !globMatch(f.ClientMatches, sess.GetClient()) {
+		return false
+	}
+	return true
+}
+
+type sessionPruneResult struct {
+	Id     string `json:"id"`
+	Client string `json:"client"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+var sessionsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Revoke Sessions matching the filters (dry-run unless --apply)",
+	Long: `Revoke Sessions matching all of the given filters. Current Session is never revoked.
+Nothing is revoked unless --apply is given, matching Sessions are only listed.
+
+Examples:
+	inf sessions prune --all-but-current --apply
+	inf sessions prune --older-than 30d --client-matches "CLI | *"
+	inf sessions prune --idle-for 7d --apply`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter := &sessionsPruneFilter{}
+		filter.All, _ = cmd.Flags().GetBool("all-but-current")
+		filter.ClientMatches, _ = cmd.Flags().GetString("client-matches")
+		for flag, d := range map[string]*time.Duration{
+			"older-than": &filter.OlderThan,
+			"idle-for":   &filter.IdleFor,
+		} {
+			if v, _ := cmd.Flags().GetString(flag); v != "" {
+				val, err := parseDuration(v)
+				if err != nil {
+					return usageError{fmt.Errorf("--%s: %w", flag, err)}
+				}
+				if val <= 0 {
+					return usageError{fmt.Errorf("--%s must be positive, got %q", flag, v)}
+				}
+				*d = val
+			}
+		}
+		if filter.empty() {
+			return errors.New("no filters given, use --all-but-current to revoke all other Sessions")
+		}
+
+		ctx := makeContextWithBearerToken()
+		client, err := makeSessionsServiceClient(ctx)
+		if err != nil {
+			return err
+		}
+
+		sess, err := client.Get(ctx, &pb.EmptyMessage{})
+		if err != nil {
+			return err
+		}
+
+		var act *sessions.Activity
+		if filter.IdleFor > 0 {
+			act, err = client.GetActivity(ctx, &pb.EmptyMessage{})
+			if err != nil {
+				return err
+			}
+		}
+
+		apply, _ := cmd.Flags().GetBool("apply")
+		now := time.Now()
+		var results []sessionPruneResult
+		failed := 0
+		for _, s := range sess.GetSessions() {
+			if !filter.match(s, act, now) {
+				continue
+			}
+
+			res := sessionPruneResult{Id: s.GetId(), Client: s.GetClient(), Result: "Would revoke"}
+			if apply {
+				if _, err := client.Revoke(ctx, &sessions.Session{Id: s.GetId()}); err != nil {
+					res.Result = "Failed"
+					res.Error = makeCLIError(err).Message
+					failed++
+				} else {
+					res.Result = "Revoked"
+				}
+			}
+			results = append(results, res)
+		}
+
+		if err := printOutput(cmd, results, sessionsPruneTable(results)); err != nil {
+			return err
+		}
+		if !apply && len(results) > 0 && outputFormat(cmd) == OUTPUT_TABLE {
+			fmt.Println("Dry run, use --apply to revoke these Sessions")
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("failed to revoke %d of %d Sessions", failed, len(results))
+		}
+		return nil
+	},
+}
+
+func sessionsPruneTable(results []sessionPruneResult) *Table {
+	return NewTable("session", results, func(res sessionPruneResult) string { return res.Id },
+		Column[sessionPruneResult]{Name: "ID", Value: func(res sessionPruneResult) interface{} { return res.Id }},
+		Column[sessionPruneResult]{Name: "Client", Value: func(res sessionPruneResult) interface{} {
+			if res.Client == "" {
+				return "N/A"
+			}
+			return res.Client
+		}},
+		Column[sessionPruneResult]{Name: "Result", Value: func(res sessionPruneResult) interface{} { return res.Result }},
+		Column[sessionPruneResult]{Name: "Error", Value: func(res sessionPruneResult) interface{} { return res.Error }},
+	)
+}
+
+func init() {
+	sessionsPruneCmd.Flags().Bool("all-but-current", false, "Match all Sessions except the current one")
+	sessionsPruneCmd.Flags().String("older-than", "", "Match Sessions created longer ago than given duration, e.g. 30d or 12h")
+	sessionsPruneCmd.Flags().String("idle-for", "", "Match Sessions not seen for given duration, e.g. 7d (uses Activity)")
+	sessionsPruneCmd.Flags().String("client-matches", "", "Match Sessions by Client glob pattern, e.g. \"CLI | *\"")
+	sessionsPruneCmd.Flags().Bool("apply", false, "Actually revoke matched Sessions")
+
+	sessionsCmd.AddCommand(sessionsPruneCmd)
+}
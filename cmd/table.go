@@ -0,0 +1,555 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+// Column of the resources Table, Value extracts the cell from the resource
+type Column[T any] struct {
+	Name string
+	// Wide columns are only shown in wide and csv output
+	Wide bool
+	// Hidden columns are never shown, but can be sorted by
+	Hidden bool
+	Value  func(T) interface{}
+}
+
+type tableColumn struct {
+	Name   string
+	Wide   bool
+	Hidden bool
+}
+
+type tableRow struct {
+	Name  string
+	Item  interface{}
+	Cells []interface{}
+
+	// json representation of the Item, see (*Table).generic
+	obj interface{}
+}
+
+// Table is human readable representation of the resources pool
+type Table struct {
+	Kind    string
+	Columns []tableColumn
+	Rows    []tableRow
+	SortBy  []table.SortBy
+	// Field of the response the rows are listed in, see ListedIn
+	Field string
+}
+
+// NewTable makes Table of the given kind out of resources pool, name is used for -o name
+func NewTable[T any](kind string, pool []T, name func(T) string, columns ...Column[T]) *Table {
+	t := &Table{Kind: kind}
+	for _, col := range columns {
+		t.Columns = append(t.Columns, tableColumn{Name: col.Name, Wide: col.Wide, Hidden: col.Hidden})
+	}
+
+	for _, item := range pool {
+		row := tableRow{Name: name(item), Item: item}
+		for _, col := range columns {
+			row.Cells = append(row.Cells, col.Value(item))
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t
+}
+
+// Sort sets default rows order
+func (t *Table) Sort(by ...table.SortBy) *Table {
+	t.SortBy = by
+	return t
+}
+
+// ListedIn sets the response field holding the resources, so the filtered response keeps its shape
+func (t *Table) ListedIn(field string) *Table {
+	t.Field = field
+	return t
+}
+
+// Items returns resources left in the Table after filtering
+func (t *Table) Items() []interface{} {
+	items := make([]interface{}, len(t.Rows))
+	for i, row := range t.Rows {
+		items[i] = row.Item
+	}
+	return items
+}
+
+// filteredData replaces resources in data with ones left in the Table after filtering.
+// Data listing resources in the Field keeps the rest of it, map of resources is filtered by the row names
+func (t *Table) filteredData(data interface{}) (interface{}, error) {
+	items, err := toGeneric(t.Items())
+	if err != nil {
+		return nil, err
+	}
+	if t.Field == "" {
+		return items, nil
+	}
+
+	obj, err := toGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := obj.(map[string]interface{})
+	if !ok {
+		return items, nil
+	}
+
+	if pool, ok := res[t.Field].(map[string]interface{}); ok {
+		filtered := make(map[string]interface{}, len(t.Rows))
+		for _, row := range t.Rows {
+			if v, ok := pool[row.Name]; ok {
+				filtered[row.Name] = v
+			}
+		}
+		res[t.Field] = filtered
+		return res, nil
+	}
+
+	res[t.Field] = items
+	return res, nil
+}
+
+// Writer makes go-pretty Writer out of the Table
+func (t *Table) Writer(wide, footer bool) table.Writer {
+	w := table.NewWriter()
+	w.SetOutputMirror(os.Stdout)
+
+	header := make(table.Row, len(t.Columns))
+	configs := make([]table.ColumnConfig, len(t.Columns))
+	var visible []int
+	for i, col := range t.Columns {
+		header[i] = col.Name
+		configs[i] = table.ColumnConfig{Number: i + 1, Hidden: col.Hidden || (col.Wide && !wide)}
+		if !configs[i].Hidden {
+			visible = append(visible, i)
+		}
+	}
+	w.AppendHeader(header)
+	w.SetColumnConfigs(configs)
+
+	t.sort()
+	for _, row := range t.Rows {
+		w.AppendRow(row.Cells)
+	}
+
+	if footer && len(visible) > 1 {
+		row := make(table.Row, len(t.Columns))
+		for i := range row {
+			row[i] = ""
+		}
+		row[visible[len(visible)-2]] = "Total Found"
+		row[visible[len(visible)-1]] = len(t.Rows)
+		w.AppendFooter(row, table.RowConfig{AutoMerge: true})
+	}
+	return w
+}
+
+// Render prints the Table to stdout
+func (t *Table) Render(wide bool) {
+	t.Writer(wide, true).Render()
+}
+
+// RenderTo prints the Table to the given writer, e.g. stderr for previews
+func (t *Table) RenderTo(out io.Writer, wide bool) {
+	w := t.Writer(wide, true)
+	w.SetOutputMirror(out)
+	w.Render()
+}
+
+// normalizeColumnName makes "Default NS", "default-ns" and "default_ns" the same
+func normalizeColumnName(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "", "_", "").Replace(name))
+}
+
+// column returns index of the column by its name, -1 if there's no such column
+func (t *Table) column(name string) int {
+	name = normalizeColumnName(name)
+	for i, col := range t.Columns {
+		if normalizeColumnName(col.Name) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// generic returns json representation of the row resource, used by jsonpath keys
+func (t *Table) generic(i int) (interface{}, error) {
+	if t.Rows[i].obj == nil {
+		obj, err := toGeneric(t.Rows[i].Item)
+		if err != nil {
+			return nil, err
+		}
+		t.Rows[i].obj = obj
+	}
+	return t.Rows[i].obj, nil
+}
+
+// values returns row values by key, being either column name or jsonpath of the resource like .title
+func (t *Table) values(i int, key string) ([]interface{}, error) {
+	if !strings.HasPrefix(key, ".") {
+		if col := t.column(key); col >= 0 {
+			return []interface{}{t.Rows[i].Cells[col]}, nil
+		}
+		// Not a column, could be the resource field
+		key = "." + key
+	}
+
+	obj, err := t.generic(i)
+	if err != nil {
+		return nil, err
+	}
+	return evalJsonPath(key, obj)
+}
+
+// compareValues compares numbers numerically, bools as false < true and anything else as strings
+func compareValues(a, b interface{}) int {
+	af, aNum := toFloat(a)
+	bf, bNum := toFloat(b)
+	if aNum && bNum {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case int:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case float64:
+		return val, true
+	case bool:
+		if val {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// sort orders rows by SortBy, columns are referenced by Name or Number
+func (t *Table) sort() {
+	if len(t.SortBy) == 0 {
+		return
+	}
+
+	sort.SliceStable(t.Rows, func(i, j int) bool {
+		for _, by := range t.SortBy {
+			col := by.Number - 1
+			if by.Name != "" {
+				col = t.column(by.Name)
+			}
+			if col < 0 || col >= len(t.Columns) {
+				continue
+			}
+
+			res := compareValues(t.Rows[i].Cells[col], t.Rows[j].Cells[col])
+			if res == 0 {
+				continue
+			}
+			if by.Mode == table.Dsc || by.Mode == table.DscNumeric {
+				return res > 0
+			}
+			return res < 0
+		}
+		return false
+	})
+}
+
+// sortByKey orders rows by column or jsonpath, prefix it with - to sort descending
+func (t *Table) sortByKey(key string) error {
+	desc := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+
+	keys := make([]interface{}, len(t.Rows))
+	for i := range t.Rows {
+		res, err := t.values(i, key)
+		if err != nil {
+			return err
+		}
+		if len(res) > 0 {
+			keys[i] = res[0]
+		}
+	}
+
+	idx := make([]int, len(t.Rows))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		res := compareValues(keys[idx[i]], keys[idx[j]])
+		if desc {
+			return res > 0
+		}
+		return res < 0
+	})
+
+	rows := make([]tableRow, len(t.Rows))
+	for i, k := range idx {
+		rows[i] = t.Rows[k]
+	}
+	t.Rows = rows
+	t.SortBy = nil
+	return nil
+}
+
+// tableFilter is a single --filter condition, like enabled==false or title~=pump-*
+type tableFilter struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// Filter operators, two characters ones go first to win over = at the same position
+var TABLE_FILTER_OPS = []string{"==", "!=", "~=", "="}
+
+// parseTableFilters parses comma separated conditions, each split at the leftmost operator
+func parseTableFilters(expr string) ([]tableFilter, error) {
+	var filters []tableFilter
+	for _, cond := range strings.Split(expr, ",") {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+
+		var f *tableFilter
+		pos := len(cond)
+		for _, op := range TABLE_FILTER_OPS {
+			if i := strings.Index(cond, op); i > 0 && i < pos {
+				f = &tableFilter{Key: strings.TrimSpace(cond[:i]), Op: op, Value: strings.TrimSpace(cond[i+len(op):])}
+				pos = i
+			}
+		}
+		if f == nil || f.Key == "" {
+			return nil, fmt.Errorf("invalid filter %q, expected <key><op><value> with op one of %s", cond, strings.Join(TABLE_FILTER_OPS, ", "))
+		}
+		if strings.HasPrefix(f.Key, "!") {
+			return nil, fmt.Errorf("invalid filter %q, use != to negate the condition", cond)
+		}
+		if f.Op == "=" {
+			f.Op = "=="
+		}
+		filters = append(filters, *f)
+	}
+	return filters, nil
+}
+
+// match tells whether any of the values (or elements of array values) matches the condition
+func (f tableFilter) match(values []interface{}) bool {
+	var flat []interface{}
+	for _, v := range values {
+		if arr, ok := v.([]interface{}); ok {
+			flat = append(flat, arr...)
+		} else {
+			flat = append(flat, v)
+		}
+	}
+
+	matched := false
+	for _, v := range flat {
+		s := formatJsonValue(v)
+		switch f.Op {
+		case "==":
+			matched = strings.EqualFold(s, f.Value)
+		case "~=":
+			matched = globMatch(f.Value, s)
+		case "!=":
+			matched = strings.EqualFold(s, f.Value)
+		}
+		if matched {
+			break
+		}
+	}
+	if f.Op == "!=" {
+		return !matched
+	}
+	return matched
+}
+
+// filter keeps rows matching all of the conditions
+func (t *Table) filter(filters []tableFilter) error {
+	var rows []tableRow
+	for i := range t.Rows {
+		ok := true
+		for _, f := range filters {
+			values, err := t.values(i, f.Key)
+			if err != nil {
+				return err
+			}
+			if !f.match(values) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			rows = append(rows, t.Rows[i])
+		}
+	}
+	t.Rows = rows
+	return nil
+}
+
+// selectColumns leaves only the given columns in the given order, wide columns are shown if requested explicitly
+func (t *Table) selectColumns(names []string) error {
+	var idx []int
+	for _, name := range names {
+		col := t.column(strings.TrimSpace(name))
+		if col < 0 {
+			available := make([]string, 0, len(t.Columns))
+			for _, c := range t.Columns {
+				if !c.Hidden {
+					available = append(available, normalizeColumnName(c.Name))
+				}
+			}
+			return fmt.Errorf("unknown column %q, available are: %s", name, strings.Join(available, ", "))
+		}
+		idx = append(idx, col)
+	}
+
+	columns := make([]tableColumn, len(idx))
+	for i, col := range idx {
+		columns[i] = tableColumn{Name: t.Columns[col].Name}
+	}
+	for r := range t.Rows {
+		cells := make([]interface{}, len(idx))
+		for i, col := range idx {
+			cells[i] = t.Rows[r].Cells[col]
+		}
+		t.Rows[r].Cells = cells
+	}
+	t.Columns = columns
+	t.SortBy = nil
+	return nil
+}
+
+// customColumns replaces columns with the given spec, like NAME:.title,TAGS:.tags[*]
+func (t *Table) customColumns(spec string) error {
+	var columns []tableColumn
+	var paths []string
+	for _, def := range strings.Split(spec, ",") {
+		name, path, ok := strings.Cut(def, ":")
+		if !ok || name == "" || path == "" {
+			return fmt.Errorf("invalid custom column %q, expected NAME:.path", def)
+		}
+		columns = append(columns, tableColumn{Name: name})
+		paths = append(paths, path)
+	}
+
+	for r := range t.Rows {
+		obj, err := t.generic(r)
+		if err != nil {
+			return err
+		}
+		cells := make([]interface{}, len(paths))
+		for i, path := range paths {
+			res, err := evalJsonPath(path, obj)
+			if err != nil {
+				return err
+			}
+			values := make([]string, len(res))
+			for j, v := range res {
+				values[j] = formatJsonValue(v)
+			}
+			cells[i] = strings.Join(values, ",")
+			if len(res) == 0 {
+				cells[i] = "<none>"
+			}
+		}
+		t.Rows[r].Cells = cells
+	}
+	t.Columns = columns
+	t.SortBy = nil
+	return nil
+}
+
+// applyListFlags filters, sorts, limits and picks columns as requested by list flags
+// Returns true if the Table rows were changed, so the output shouldn't be the full response anymore
+func (t *Table) applyListFlags(cmd *cobra.Command) (bool, error) {
+	changed := false
+	if expr, _ := cmd.Flags().GetString("filter"); expr != "" {
+		filters, err := parseTableFilters(expr)
+		if err != nil {
+			return false, err
+		}
+		if err := t.filter(filters); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	if key, _ := cmd.Flags().GetString("sort-by"); key != "" {
+		if err := t.sortByKey(key); err != nil {
+			return false, err
+		}
+		changed = true
+	} else {
+		t.sort()
+	}
+
+	if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 && limit < len(t.Rows) {
+		t.Rows = t.Rows[:limit]
+		changed = true
+	}
+
+	if columns, _ := cmd.Flags().GetStringSlice("columns"); len(columns) > 0 {
+		if err := t.selectColumns(columns); err != nil {
+			return false, err
+		}
+	}
+	if spec, _ := cmd.Flags().GetString("custom-columns"); spec != "" {
+		if err := t.customColumns(spec); err != nil {
+			return false, err
+		}
+	}
+	return changed, nil
+}
+
+// addListFlags adds flags to pick columns, filter, sort and limit the list
+func addListFlags(cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		cmd.Flags().StringSlice("columns", nil, "Columns to show, e.g. uuid,title,tags,enabled")
+		cmd.Flags().String("custom-columns", "", "Custom columns as NAME:.jsonpath, e.g. NAME:.title,TAGS:.tags[*]")
+		cmd.Flags().String("sort-by", "", "Column or .jsonpath to sort by, prefix with - for descending order")
+		cmd.Flags().String("filter", "", "Comma separated conditions as <column|.jsonpath><==|!=|~=><value>, e.g. enabled==false")
+		cmd.Flags().Int("limit", 0, "Show only first N rows")
+		cmd.MarkFlagsMutuallyExclusive("columns", "custom-columns")
+	}
+}
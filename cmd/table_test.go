@@ -0,0 +1,170 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTableFilters(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    []tableFilter
+		wantErr bool
+	}{
+		{expr: "enabled==false", want: []tableFilter{{"enabled", "==", "false"}}},
+		{expr: "enabled=false", want: []tableFilter{{"enabled", "==", "false"}}},
+		{expr: "enabled!=false", want: []tableFilter{{"enabled", "!=", "false"}}},
+		{expr: "title~=pump-*", want: []tableFilter{{"title", "~=", "pump-*"}}},
+		{expr: " title ~= pump-* , enabled = true ", want: []tableFilter{{"title", "~=", "pump-*"}, {"enabled", "==", "true"}}},
+		{expr: "a==b,,", want: []tableFilter{{"a", "==", "b"}}},
+		{expr: "", want: nil},
+		// Leftmost operator splits the condition, the rest is the value
+		{expr: "title==a=b", want: []tableFilter{{"title", "==", "a=b"}}},
+		{expr: "title=a==b", want: []tableFilter{{"title", "==", "a==b"}}},
+		{expr: "title=x~=y", want: []tableFilter{{"title", "==", "x~=y"}}},
+		{expr: "title~=a==b", want: []tableFilter{{"title", "~=", "a==b"}}},
+		{expr: "title!=a~=b", want: []tableFilter{{"title", "!=", "a~=b"}}},
+		{expr: "title!==a", want: []tableFilter{{"title", "!=", "=a"}}},
+		{expr: "title=!a", want: []tableFilter{{"title", "==", "!a"}}},
+		{expr: "title==", want: []tableFilter{{"title", "==", ""}}},
+		{expr: ".tags[0]==x", want: []tableFilter{{".tags[0]", "==", "x"}}},
+		{expr: "!enabled==true", wantErr: true},
+		{expr: "!=x", wantErr: true},
+		{expr: "==x", wantErr: true},
+		{expr: " =x", wantErr: true},
+		{expr: "enabled", wantErr: true},
+		{expr: "a==b,enabled", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTableFilters(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseTableFilters(%q) = %v, want error", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTableFilters(%q) = %v, %v, want %v", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestTableFilterMatch(t *testing.T) {
+	tests := []struct {
+		filter tableFilter
+		values []interface{}
+		want   bool
+	}{
+		{tableFilter{"k", "==", "false"}, []interface{}{false}, true},
+		{tableFilter{"k", "==", "Pump"}, []interface{}{"pump"}, true},
+		{tableFilter{"k", "==", "1"}, []interface{}{float64(1)}, true},
+		{tableFilter{"k", "==", "x"}, nil, false},
+		{tableFilter{"k", "!=", "x"}, nil, true},
+		{tableFilter{"k", "!=", "x"}, []interface{}{"y"}, true},
+		{tableFilter{"k", "!=", "x"}, []interface{}{[]interface{}{"y", "x"}}, false},
+		{tableFilter{"k", "==", "x"}, []interface{}{[]interface{}{"y", "x"}}, true},
+		{tableFilter{"k", "~=", "pump-*"}, []interface{}{"pump-1"}, true},
+		{tableFilter{"k", "~=", "pump-*"}, []interface{}{"my-pump-1"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.match(tt.values); got != tt.want {
+			t.Errorf("%v.match(%v) = %v, want %v", tt.filter, tt.values, got, tt.want)
+		}
+	}
+}
+
+type tableTestItem struct {
+	Uuid    string `json:"uuid"`
+	Enabled bool   `json:"enabled"`
+}
+
+func tableTestItems() []tableTestItem {
+	return []tableTestItem{{"a", true}, {"b", false}, {"c", true}}
+}
+
+func newTableTestTable() *Table {
+	return NewTable("item", tableTestItems(), func(item tableTestItem) string { return item.Uuid },
+		Column[tableTestItem]{Name: "UUID", Value: func(item tableTestItem) interface{} { return item.Uuid }},
+		Column[tableTestItem]{Name: "Enabled", Value: func(item tableTestItem) interface{} { return item.Enabled }},
+	)
+}
+
+func TestTableFilteredData(t *testing.T) {
+	filters, err := parseTableFilters("enabled==true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		map[string]interface{}{"uuid": "a", "enabled": true},
+		map[string]interface{}{"uuid": "c", "enabled": true},
+	}
+
+	// Response listing resources in the field keeps its other fields
+	tbl := newTableTestTable().ListedIn("items")
+	if err := tbl.filter(filters); err != nil {
+		t.Fatal(err)
+	}
+	got, err := tbl.filteredData(map[string]interface{}{"items": tableTestItems(), "total": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, map[string]interface{}{"items": want, "total": float64(3)}) {
+		t.Errorf("filteredData of listed response = %v", got)
+	}
+
+	// Plain list stays a list
+	tbl = newTableTestTable()
+	if err := tbl.filter(filters); err != nil {
+		t.Fatal(err)
+	}
+	got, err = tbl.filteredData(tableTestItems())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filteredData of list = %v", got)
+	}
+
+	// Map of resources is filtered by names
+	tbl = NewTable("provider", []string{"a", "b"}, func(key string) string { return key },
+		Column[string]{Name: "Key", Value: func(key string) interface{} { return key }},
+	).ListedIn("providers")
+	if err := tbl.filter([]tableFilter{{"key", "!=", "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = tbl.filteredData(map[string]interface{}{"providers": map[string]string{"a": "A", "b": "B"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, map[string]interface{}{"providers": map[string]interface{}{"b": "B"}}) {
+		t.Errorf("filteredData of map = %v", got)
+	}
+
+	// Nothing left is still a list
+	tbl = newTableTestTable().ListedIn("items")
+	if err := tbl.filter([]tableFilter{{"uuid", "==", "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = tbl.filteredData(map[string]interface{}{"items": tableTestItems()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, map[string]interface{}{"items": []interface{}{}}) {
+		t.Errorf("filteredData with nothing left = %#v", got)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/viper"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// currentTLSConfig returns TLS settings of the current context
+func currentTLSConfig() *TLSConfig {
+	return &TLSConfig{
+		CA:          viper.GetString("tls.ca"),
+		ServerName:  viper.GetString("tls.server-name"),
+		SkipVerify:  viper.GetBool("tls.skip-verify"),
+		Fingerprint: viper.GetString("tls.fingerprint"),
+		ClientCert:  viper.GetString("tls.client-cert"),
+		ClientKey:   viper.GetString("tls.client-key"),
+		PKCS12:      viper.GetString("tls.pkcs12"),
+	}
+}
+
+// makeTLSConfig builds tls.Config out of context TLS settings,
+// pinning server certificate fingerprint upon first use via onPin
+func makeTLSConfig(conf *TLSConfig, onPin func(fingerprint string)) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.SkipVerify,
+	}
+
+	if conf.CA != "" {
+		bundle, err := os.ReadFile(conf.CA)
+		if err != nil {
+			return nil, fmt.Errorf("can't read CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", conf.CA)
+		}
+		config.RootCAs = pool
+	}
+
+	cert, err := loadClientCertificate(conf)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server presented no certificates")
+		}
+
+		fingerprint := certificateFingerprint(cs.PeerCertificates[0])
+		if conf.Fingerprint == "" {
+			conf.Fingerprint = fingerprint
+			if onPin != nil {
+				onPin(fingerprint)
+			}
+			return nil
+		}
+
+		if !strings.EqualFold(conf.Fingerprint, fingerprint) {
+			fmt.Fprintf(os.Stderr, `@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+@    WARNING: SERVER CERTIFICATE HAS CHANGED!            @
+@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@
+It is possible that someone is intercepting the connection.
+Pinned fingerprint:    %s
+Presented fingerprint: %s
+If the server certificate was changed legitimately, unpin it by running:
+  inf config set tls.fingerprint ""
+`, conf.Fingerprint, fingerprint)
+			return fmt.Errorf("server certificate fingerprint mismatch: expected %s, got %s", conf.Fingerprint, fingerprint)
+		}
+
+		return nil
+	}
+
+	return config, nil
+}
+
+// loadClientCertificate loads mutual TLS client certificate if one is configured
+func loadClientCertificate(conf *TLSConfig) (*tls.Certificate, error) {
+	if conf.PKCS12 != "" {
+		data, err := os.ReadFile(conf.PKCS12)
+		if err != nil {
+			return nil, fmt.Errorf("can't read PKCS#12 bundle: %w", err)
+		}
+
+		password, ok := os.LookupEnv("INF_PKCS12_PASSWORD")
+		if !ok && isInteractive() {
+			prompt := promptui.Prompt{
+				Label: "PKCS#12 Password",
+				Mask:  '*',
+			}
+			if password, err = prompt.Run(); err != nil {
+				return nil, err
+			}
+		}
+
+		return decodePKCS12(data, password)
+	}
+
+	if conf.ClientCert == "" && conf.ClientKey == "" {
+		return nil, nil
+	}
+	if conf.ClientCert == "" || conf.ClientKey == "" {
+		return nil, errors.New("both client certificate and key must be given")
+	}
+
+	cert, err := tls.LoadX509KeyPair(conf.ClientCert, conf.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't load client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// decodePKCS12 reads private key and certificate chain out of PKCS#12 bundle
+func decodePKCS12(data []byte, password string) (*tls.Certificate, error) {
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode PKCS#12 bundle: %w", err)
+	}
+
+	cert := &tls.Certificate{PrivateKey: key, Leaf: leaf, Certificate: [][]byte{leaf.Raw}}
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert, nil
+}
+
+// pinCurrentContext stores pinned fingerprint in the current context
+// Nothing is stored when connected to other host than the context's one, e.g. given with INF_HOST
+func pinCurrentContext(fingerprint string) {
+	ctx, ok := infConfig.Contexts[infContext]
+	if !ok {
+		return
+	}
+	if host := viper.GetString("infinimesh"); host != ctx.Host {
+		fmt.Fprintf(os.Stderr, "Warning: not pinning server certificate with fingerprint %s, host %s isn't the context host %s\n", fingerprint, host, ctx.Host)
+		return
+	}
+	if ctx.TLS == nil {
+		ctx.TLS = &TLSConfig{}
+	}
+	ctx.TLS.Fingerprint = fingerprint
+
+	if err := infConfig.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, "Can't pin server certificate:", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Pinned server certificate with fingerprint %s\n", fingerprint)
+}
+
+// certificateFingerprint returns hex encoded SHA-256 of DER certificate
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
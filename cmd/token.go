@@ -0,0 +1,319 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	hfpb "github.com/infinimesh/proto/handsfree"
+	pb "github.com/infinimesh/proto/node"
+	accpb "github.com/infinimesh/proto/node/accounts"
+	"github.com/manifoldco/promptui"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Warn about token expiration if it expires sooner than this
+const TOKEN_EXPIRY_WARNING = 24 * time.Hour
+
+// Renew streaming tokens this long before they expire
+const TOKEN_RENEW_BEFORE = time.Minute
+
+// Streams give up after this many reconnects in a row without any message
+const STREAM_RENEW_ATTEMPTS = 5
+
+// Backoff between failed stream reconnects, doubled on each attempt
+const (
+	STREAM_RENEW_BACKOFF     = time.Second
+	STREAM_RENEW_MAX_BACKOFF = 30 * time.Second
+)
+
+// How long to wait for Handsfree code approval when re-authenticating
+const HANDSFREE_TIMEOUT = 5 * time.Minute
+
+// TokenClaims are JWT claims the CLI is interested in
+type TokenClaims struct {
+	Account   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// parseTokenClaims reads claims from JWT token without verifying it
+func parseTokenClaims(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// tokenExpires reads expiration time from JWT token claims without verifying it
+func tokenExpires(token string) (time.Time, error) {
+	claims, err := parseTokenClaims(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if claims.ExpiresAt == 0 {
+		return time.Time{}, errors.New("token has no expiration")
+	}
+
+	return time.Unix(claims.ExpiresAt, 0), nil
+}
+
+// warnTokenExpiry prints warning if token is expired or about to expire
+func warnTokenExpiry(token string) {
+	exp, err := tokenExpires(token)
+	if err != nil {
+		return
+	}
+
+	left := time.Until(exp)
+	if left <= 0 {
+		fmt.Fprintf(os.Stderr, "[WARN] Token has expired at %s, run inf login\n", exp.Format(time.RFC1123))
+	} else if left < TOKEN_EXPIRY_WARNING {
+		fmt.Fprintf(os.Stderr, "[WARN] Token expires in %s\n", left.Round(time.Minute))
+	}
+}
+
+// isInteractive tells whether CLI is run in terminal, so user can be prompted
+func isInteractive() bool {
+	return isTerminal(os.Stdin, os.Stderr)
+}
+
+// isTerminal tells whether all of the files are terminals
+func isTerminal(files ...*os.File) bool {
+	for _, f := range files {
+		stat, err := f.Stat()
+		if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func makeCredentials(authType, login, password, ldapProvider string) *accpb.Credentials {
+	if authType == "" {
+		authType = "standard"
+	}
+
+	data := []string{login, password}
+	if authType == "ldap" {
+		data = append(data, ldapProvider)
+	}
+	return &accpb.Credentials{
+		Type: authType, Data: data,
+	}
+}
+
+// requestToken exchanges credentials for the token, identifying CLI by the host it runs at
+func requestToken(ctx context.Context, client pb.AccountsServiceClient, creds *accpb.Credentials) (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	client_id := fmt.Sprintf("CLI | %s | %s", hostname, runtime.GOOS)
+	res, err := client.Token(ctx, &pb.TokenRequest{
+		Auth:   creds,
+		Client: &client_id,
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.GetToken(), nil
+}
+
+// saveToken stores token of the current context
+func saveToken(ctx *ContextConfig, token string) error {
+	store, err := makeCredentialStore(ctx)
+	if err != nil {
+		return err
+	}
+	if err := store.Set(infContext, token); err != nil {
+		return err
+	}
+
+	cachedToken = &token
+	return infConfig.Save()
+}
+
+// Handsfree App ID CLI connects as
+const HANDSFREE_APP_ID = "inf.cli"
+
+// handsfreeToken shows Handsfree auth code and waits for the token to be sent
+// by already authenticated device or Console
+func handsfreeToken(ctx context.Context, client hfpb.HandsfreeServiceClient, qr bool) (string, error) {
+	c, err := client.Connect(ctx, &hfpb.ConnectionRequest{AppId: HANDSFREE_APP_ID})
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		msg, err := c.Recv()
+		if err != nil {
+			if status.Code(err) == codes.DeadlineExceeded {
+				return "", errors.New("code wasn't approved in time")
+			}
+			return "", err
+		}
+
+		switch msg.Code {
+		case hfpb.Code_AUTH:
+			if len(msg.Payload) < 1 {
+				return "", errors.New("unexpected payload format while reading code")
+			}
+			code := strings.ToUpper(msg.Payload[0])
+			fmt.Fprintf(os.Stderr, "Approve login by entering following code in infinimesh Console: %s\n", code)
+			if qr {
+				if err := PrintQR(os.Stderr, code); err != nil {
+					return "", err
+				}
+			}
+			fmt.Fprintln(os.Stderr, "Waiting for approval...")
+		case hfpb.Code_DATA:
+			if len(msg.Payload) < 1 || msg.Payload[0] == "" {
+				return "", errors.New("no token received")
+			}
+			return msg.Payload[0], nil
+		default:
+			return "", fmt.Errorf("received unexpected response, code: %s", msg.Code.String())
+		}
+	}
+}
+
+// reauth state is kept per run, so user is asked only once
+var (
+	reauthDeclined bool
+	staleTokens    = map[string]bool{}
+)
+
+// reauthInterceptor offers to login again if the call has failed with Unauthenticated,
+// retrying the call with the new token
+func reauthInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if status.Code(err) != codes.Unauthenticated {
+		return err
+	}
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok || len(md.Get("authorization")) == 0 {
+		return err
+	}
+	used := strings.TrimPrefix(md.Get("authorization")[0], "Bearer ")
+
+	current, _ := loadToken()
+	if used != current && !staleTokens[used] {
+		// Not the user token (e.g. device token), nothing to renew
+		return err
+	}
+
+	if used == current {
+		if reauthDeclined || !isInteractive() {
+			return err
+		}
+		if rerr := reauthenticate(cc); rerr != nil {
+			reauthDeclined = true
+			return err
+		}
+		staleTokens[used] = true
+		current, _ = loadToken()
+	}
+
+	md = md.Copy()
+	md.Set("authorization", "Bearer "+current)
+	return invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+}
+
+// reauthenticate runs login flow for the current context using stored login
+func reauthenticate(cc *grpc.ClientConn) error {
+	conf, ok := infConfig.Contexts[infContext]
+	if !ok || (conf.User == "" && conf.AuthType != "handsfree") {
+		return errors.New("no login stored for the context")
+	}
+
+	label := fmt.Sprintf("Not authenticated, login to %s as %s again", conf.Host, conf.User)
+	if conf.AuthType == "handsfree" {
+		label = fmt.Sprintf("Not authenticated, login to %s via Handsfree again", conf.Host)
+	}
+	confirm := promptui.Prompt{
+		Label:     label,
+		IsConfirm: true,
+	}
+	if _, err := confirm.Run(); err != nil {
+		return err
+	}
+
+	if conf.AuthType == "handsfree" {
+		ctx, cancel := context.WithTimeout(context.Background(), HANDSFREE_TIMEOUT)
+		defer cancel()
+
+		token, err := handsfreeToken(ctx, hfpb.NewHandsfreeServiceClient(cc), false)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Login failed:", err)
+			return err
+		}
+		return saveToken(conf, token)
+	}
+
+	prompt := promptui.Prompt{
+		Label: "Password",
+		Mask:  '*',
+	}
+	password, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+
+	token, err := requestToken(context.Background(), pb.NewAccountsServiceClient(cc), makeCredentials(conf.AuthType, conf.User, password, conf.LDAPProvider))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Login failed:", err)
+		return err
+	}
+
+	return saveToken(conf, token)
+}
+
+// streamRenewBackoff is the delay before reconnect after given number of consecutive failures
+func streamRenewBackoff(failures int) time.Duration {
+	backoff := STREAM_RENEW_BACKOFF
+	for i := 1; i < failures && backoff < STREAM_RENEW_MAX_BACKOFF; i++ {
+		backoff *= 2
+	}
+	if backoff > STREAM_RENEW_MAX_BACKOFF {
+		return STREAM_RENEW_MAX_BACKOFF
+	}
+	return backoff
+}
@@ -0,0 +1,184 @@
+/*
+Copyright © 2021-2022 Nikita Ivanovski info@slnt-opp.xyz
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/spf13/cobra"
+)
+
+// Watch events types, as printed in NDJSON mode
+const (
+	WATCH_ADDED    = "ADDED"
+	WATCH_MODIFIED = "MODIFIED"
+	WATCH_DELETED  = "DELETED"
+)
+
+// Lister fetches the list response and makes Table out of it
+type Lister func() (interface{}, *Table, error)
+
+// printList prints the list once, or keeps polling it if --watch is set
+func printList(cmd *cobra.Command, list Lister) error {
+	data, t, err := list()
+	if err != nil {
+		return err
+	}
+
+	if watch, _ := cmd.Flags().GetBool("watch"); !watch {
+		return printOutput(cmd, data, t)
+	}
+	return watchList(cmd, list, t)
+}
+
+// watchedRow is the row state from the previous poll
+type watchedRow struct {
+	Item  interface{}
+	Json  string
+	Cells []interface{}
+}
+
+// watchList polls the list every --interval, redrawing the table in place on TTY and printing NDJSON events otherwise
+func watchList(cmd *cobra.Command, list Lister, t *Table) error {
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", interval)
+	}
+
+	format := outputFormat(cmd)
+	redraw := isTerminal(os.Stdout) && (format == OUTPUT_TABLE || format == OUTPUT_WIDE)
+
+	var prev map[string]watchedRow
+	var order []string
+	for {
+		if t != nil {
+			if _, err := t.applyListFlags(cmd); err != nil {
+				return err
+			}
+
+			current := make(map[string]watchedRow, len(t.Rows))
+			var names []string
+			for _, row := range t.Rows {
+				bytes, err := marshalJson(row.Item)
+				if err != nil {
+					return err
+				}
+				current[row.Name] = watchedRow{Item: row.Item, Json: string(bytes), Cells: row.Cells}
+				names = append(names, row.Name)
+			}
+
+			if redraw {
+				redrawWatchedTable(t, prev, current, order, format == OUTPUT_WIDE, interval)
+			} else if err := printWatchEvents(t.Kind, prev, current, names, order); err != nil {
+				return err
+			}
+			prev, order = current, names
+		}
+
+		time.Sleep(interval)
+
+		var err error
+		_, t, err = list()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error while polling:", err)
+			t = nil
+		}
+	}
+}
+
+// printWatchEvents prints NDJSON event per added, changed and removed resource
+func printWatchEvents(kind string, prev, current map[string]watchedRow, names, prevNames []string) error {
+	event := func(typ, name string, item interface{}) error {
+		return printJsonResponse(map[string]interface{}{
+			"type":   typ,
+			"kind":   kind,
+			"name":   name,
+			"object": item,
+		})
+	}
+
+	for _, name := range names {
+		row := current[name]
+		old, ok := prev[name]
+		if !ok {
+			if err := event(WATCH_ADDED, name, row.Item); err != nil {
+				return err
+			}
+		} else if old.Json != row.Json {
+			if err := event(WATCH_MODIFIED, name, row.Item); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range prevNames {
+		if _, ok := current[name]; !ok {
+			if err := event(WATCH_DELETED, name, prev[name].Item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// redrawWatchedTable clears the screen and renders the table, highlighting added rows green,
+// changed yellow, and keeping removed rows red until the next poll
+func redrawWatchedTable(t *Table, prev, current map[string]watchedRow, prevNames []string, wide bool, interval time.Duration) {
+	paint := func(cells []interface{}, colors text.Colors) []interface{} {
+		res := make([]interface{}, len(cells))
+		for i, cell := range cells {
+			res[i] = colors.Sprint(cell)
+		}
+		return res
+	}
+
+	var added, changed, removed int
+	// Rows are sorted already, painted cells would sort differently
+	t.SortBy = nil
+	if prev != nil {
+		for i, row := range t.Rows {
+			old, ok := prev[row.Name]
+			if !ok {
+				t.Rows[i].Cells = paint(row.Cells, text.Colors{text.FgGreen})
+				added++
+			} else if old.Json != current[row.Name].Json {
+				t.Rows[i].Cells = paint(row.Cells, text.Colors{text.FgYellow})
+				changed++
+			}
+		}
+		for _, name := range prevNames {
+			if _, ok := current[name]; !ok {
+				t.Rows = append(t.Rows, tableRow{Name: name, Cells: paint(prev[name].Cells, text.Colors{text.FgRed, text.CrossedOut})})
+				removed++
+			}
+		}
+	}
+
+	// Move cursor home and clear the screen
+	fmt.Print("\033[H\033[2J")
+	fmt.Printf("Every %s: %s, %d added, %d changed, %d removed\n\n", interval, time.Now().Format(time.RFC1123), added, changed, removed)
+	t.Render(wide)
+}
+
+// addWatchFlags adds flags to poll the list
+func addWatchFlags(cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		cmd.Flags().BoolP("watch", "w", false, "Watch for changes, polling the list every --interval")
+		cmd.Flags().Duration("interval", 2*time.Second, "Interval to poll the list at when watching")
+	}
+}
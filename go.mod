@@ -11,10 +11,13 @@ require (
 	github.com/manifoldco/promptui v0.9.0
 	github.com/spf13/cobra v1.7.0
 	github.com/spf13/viper v1.18.2
+	golang.org/x/crypto v0.18.0
 	golang.org/x/text v0.14.0
 	google.golang.org/grpc v1.61.0
 	google.golang.org/protobuf v1.32.0
 	gopkg.in/yaml.v2 v2.4.0
+	rsc.io/qr v0.2.0
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
 require (